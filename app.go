@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bunyawats/recipes-api/cache"
+	"github.com/bunyawats/recipes-api/config"
+	handler "github.com/bunyawats/recipes-api/handlers"
+	"github.com/bunyawats/recipes-api/metrics"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/ratelimit"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	redisStore "github.com/gin-contrib/sessions/redis"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+// App owns every connection and handler of the API. It is built by NewApp,
+// served by Run and released by Close.
+type App struct {
+	cfg config.Config
+
+	// ctx is handed to handlers and background refreshes; it outlives the
+	// signal context so that requests can drain, and is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// shutdownTracing flushes spans still buffered by the exporter.
+	shutdownTracing func(context.Context) error
+
+	mongoClient  *mongo.Client
+	redisClient  *redis.Client
+	sessionStore sessions.Store
+
+	recipesHandler *handler.RecipesHandler
+	authHandler    *handler.AuthHandler
+	apiKeysHandler *handler.APIKeysHandler
+	healthHandler  *handler.HealthHandler
+	authenticators []handler.Authenticator
+	keyRing        *handler.KeyRing
+	rateLimiter    ratelimit.Limiter
+	quotas         map[string]ratelimit.Quota
+	staticRecipes  []StaticRecipe
+
+	router *gin.Engine
+}
+
+// NewApp connects to the configured stores and builds the router. Whatever
+// was opened before a failure is closed again.
+func NewApp(cfg config.Config) (_ *App, err error) {
+	app := &App{
+		cfg: cfg,
+	}
+	app.ctx, app.cancel = context.WithCancel(context.Background())
+	defer func() {
+		if err != nil {
+			app.Close()
+		}
+	}()
+
+	ctx := app.ctx
+	app.shutdownTracing, err = tracing.Setup(
+		ctx,
+		cfg.Tracing.Exporter,
+		cfg.Tracing.Endpoint,
+		cfg.Tracing.ServiceName,
+		cfg.Tracing.SampleRatio,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("set up tracing: %w", err)
+	}
+
+	var recipeStore store.RecipeStore
+	var userStore store.UserStore
+	var apiKeyStore store.APIKeyStore
+	if cfg.Mongo.URI == "" {
+		slog.Warn("MONGO_URI is not set, using in-memory recipe, user and API key stores")
+		recipeStore = store.NewMemoryStore()
+		userStore = store.NewMemoryUserStore()
+		apiKeyStore = store.NewMemoryAPIKeyStore()
+	} else {
+		app.mongoClient, err = mongo.Connect(
+			ctx,
+			options.Client().ApplyURI(cfg.Mongo.URI).SetMonitor(mongoMonitor(metrics.MongoMonitor(), tracing.MongoMonitor())),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("connect to MongoDB: %w", err)
+		}
+		database := app.mongoClient.Database(cfg.Mongo.Database)
+		mongoStore := store.NewMongoStore(database.Collection(collectionNameRecipes))
+		if err = mongoStore.EnsureIndexes(ctx); err != nil {
+			return nil, fmt.Errorf("create recipe indexes: %w", err)
+		}
+		recipeStore = mongoStore
+
+		mongoUserStore := store.NewMongoUserStore(database.Collection(collectionNameUsers))
+		if err = mongoUserStore.EnsureIndexes(ctx); err != nil {
+			return nil, fmt.Errorf("create user indexes: %w", err)
+		}
+		userStore = mongoUserStore
+
+		mongoAPIKeyStore := store.NewMongoAPIKeyStore(database.Collection(collectionNameAPIKeys))
+		if err = mongoAPIKeyStore.EnsureIndexes(ctx); err != nil {
+			return nil, fmt.Errorf("create API key indexes: %w", err)
+		}
+		apiKeyStore = mongoAPIKeyStore
+		slog.Info("connected to MongoDB", slog.String("database", cfg.Mongo.Database))
+	}
+
+	var recipeCache cache.Cache
+	var tokenStore store.TokenStore
+	var attemptStore store.AttemptStore
+	if cfg.Redis.Addr == "" {
+		slog.Warn("REDIS_URI is not set, caching, tokens, sign-in attempts and rate limits in memory and sessions stored in cookies")
+		recipeCache = cache.NewMemoryCache()
+		tokenStore = store.NewMemoryTokenStore()
+		attemptStore = store.NewMemoryAttemptStore()
+		app.rateLimiter = ratelimit.NewMemoryLimiter()
+		app.sessionStore = cookie.NewStore([]byte(cfg.Session.Secret))
+	} else {
+		app.redisClient = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		if err := app.redisClient.Ping().Err(); err != nil {
+			slog.Error("ping Redis failed", slog.String("addr", cfg.Redis.Addr), slog.Any("error", err))
+		} else {
+			slog.Info("connected to Redis", slog.String("addr", cfg.Redis.Addr))
+		}
+		recipeCache = cache.NewRedisCache(app.redisClient)
+		tokenStore = store.NewRedisTokenStore(app.redisClient)
+		attemptStore = store.NewRedisAttemptStore(app.redisClient)
+		app.rateLimiter = ratelimit.NewFallbackLimiter(
+			ratelimit.NewRedisLimiter(app.redisClient),
+			ratelimit.NewMemoryLimiter(),
+		)
+
+		app.sessionStore, err = redisStore.NewStoreWithDB(
+			10,
+			"tcp",
+			cfg.Redis.Addr,
+			cfg.Redis.Password,
+			strconv.Itoa(cfg.Redis.DB),
+			[]byte(cfg.Session.Secret),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("connect to Redis: %w", err)
+		}
+	}
+
+	app.recipesHandler = handler.NewRecipesHandler(
+		ctx,
+		cfg.Cache,
+		recipeStore,
+		recipeCache,
+	)
+
+	// Tokens are signed with the first of the configured PEM key files, or
+	// with the JWT secret when there are none.
+	if len(cfg.Auth.SigningKeys) > 0 {
+		app.keyRing, err = handler.LoadKeyRing(cfg.Auth.SigningKeys, cfg.Auth.Tokens)
+		if err != nil {
+			return nil, fmt.Errorf("load JWT signing keys: %w", err)
+		}
+		go app.reloadOnHangup()
+	} else {
+		app.keyRing = handler.NewHMACKeyRing(cfg.Auth.JWTSecret, cfg.Auth.Tokens)
+	}
+
+	lockoutPolicy := handler.DefaultLockoutPolicy
+	lockoutPolicy.Threshold = cfg.Auth.Lockout.Threshold
+	lockoutPolicy.Lockout = cfg.Auth.Lockout.Duration
+
+	app.authHandler = handler.NewAuthHandler(
+		ctx,
+		cfg.Auth,
+		userStore,
+		tokenStore,
+		app.keyRing,
+		handler.NewLoginThrottle(attemptStore, lockoutPolicy),
+	)
+	app.apiKeysHandler = handler.NewAPIKeysHandler(ctx, apiKeyStore)
+
+	app.authenticators, err = handler.NewAuthenticators(ctx, cfg.Auth, app.keyRing, tokenStore, apiKeyStore, userStore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication configuration: %w", err)
+	}
+
+	// Public and sign-in routes are counted per client IP, the others per
+	// user or API key.
+	app.quotas, err = cfg.RateLimit.Quotas()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limits: %w", err)
+	}
+
+	app.healthHandler = app.healthChecks()
+
+	app.staticRecipes = make([]StaticRecipe, 0)
+	if err = json.Unmarshal(jsonByte, &app.staticRecipes); err != nil {
+		return nil, fmt.Errorf("load static recipes: %w", err)
+	}
+	slog.Debug("loaded static recipes", slog.Int("count", len(app.staticRecipes)))
+
+	if err = app.routes(); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (app *App) routes() error {
+	router := gin.New()
+	if err := router.SetTrustedProxies(app.cfg.Server.TrustedProxies); err != nil {
+		return err
+	}
+	router.Use(
+		handler.RequestTracing(),
+		handler.RequestLogger(slog.Default()),
+		handler.RequestMetrics(),
+		handler.Recovery(),
+	)
+	router.Use(sessions.Sessions(sessionKey, app.sessionStore))
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(handler.NoRouteHandler)
+	router.NoMethod(handler.NoMethodHandler)
+
+	templateFile, err := template.New("").ParseFS(templatesFS, "templates/*.tmpl")
+	if err != nil {
+		return err
+	}
+	fsys, err := fs.Sub(assetsFS, "assets")
+	if err != nil {
+		return err
+	}
+
+	router.SetHTMLTemplate(templateFile)
+	router.StaticFS("/assets", http.FS(fsys))
+
+	// Probes and metrics are neither rate limited nor authenticated.
+	router.GET("/healthz", app.healthHandler.LivenessHandler)
+	router.GET("/readyz", app.healthHandler.ReadinessHandler)
+	router.GET("/metrics", handler.MetricsHandler())
+
+	public := router.Group("/")
+	public.Use(app.rateLimit("public"))
+	{
+		public.GET("/", app.IndexHandler)
+		public.GET("/recipes/:id", app.RecipeByIDHandler)
+
+		public.GET("/recipes", app.recipesHandler.ListRecipesHandler)
+		public.GET("/recipes/search", app.recipesHandler.SearchRecipesHandler)
+		public.GET("/.well-known/jwks.json", app.keyRing.JWKSHandler)
+	}
+
+	accounts := router.Group("/")
+	accounts.Use(app.rateLimit("auth"))
+	{
+		accounts.POST("/signup", app.authHandler.SignUpHandler)
+		accounts.POST("/signin", app.authHandler.SignInHandler)
+		accounts.POST("/token", app.authHandler.SignInForJwtHandler)
+		accounts.POST("/refresh", app.authHandler.RefreshHandler)
+		accounts.POST("/signout", app.authHandler.SignOutHandler)
+	}
+
+	authorized := router.Group("/")
+	authorized.Use(handler.Authenticate(app.authenticators...), app.rateLimit("api"))
+	{
+		authorized.GET("/me", app.authHandler.MeHandler)
+		authorized.PUT("/me/password", app.authHandler.ChangePasswordHandler)
+		authorized.GET("/keys", app.apiKeysHandler.ListAPIKeysHandler)
+		authorized.POST("/keys", app.apiKeysHandler.NewAPIKeyHandler)
+		authorized.GET("/keys/:id", app.apiKeysHandler.GetAPIKeyHandler)
+		authorized.DELETE("/keys/:id", app.apiKeysHandler.DeleteAPIKeyHandler)
+
+		editors := authorized.Group("/")
+		editors.Use(handler.RequireRole(models.RoleAdmin, models.RoleEditor), app.rateLimit("write"))
+		{
+			editors.POST("/recipes", app.recipesHandler.NewRecipeHandler)
+			editors.PUT("/recipes/:id", app.recipesHandler.UpdateRecipeHandler)
+		}
+
+		admins := authorized.Group("/")
+		admins.Use(handler.RequireRole(models.RoleAdmin))
+		{
+			admins.DELETE("/recipes/:id", app.recipesHandler.DeleteRecipesHandler)
+			admins.GET("/cache/stats", app.recipesHandler.CacheStatsHandler)
+			admins.GET("/users", app.authHandler.ListUsersHandler)
+			admins.POST("/users/:username/disable", app.authHandler.DisableUserHandler)
+			admins.POST("/users/:username/enable", app.authHandler.EnableUserHandler)
+			admins.POST("/users/:username/unlock", app.authHandler.UnlockUserHandler)
+		}
+	}
+
+	app.router = router
+	return nil
+}
+
+// Run serves HTTP until ctx is cancelled, then stops accepting connections,
+// waits up to the shutdown timeout for in-flight requests and closes the
+// App.
+func (app *App) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              app.cfg.Server.Addr,
+		Handler:           app.router,
+		ReadHeaderTimeout: app.cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       app.cfg.Server.ReadTimeout,
+		WriteTimeout:      app.cfg.Server.WriteTimeout,
+		IdleTimeout:       app.cfg.Server.IdleTimeout,
+	}
+
+	//err = server.ListenAndServeTLS(
+	//	"certs/localhost.crt",
+	//	"certs/localhost.key",
+	//)
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", slog.String("addr", server.Addr))
+		serveErr <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		slog.Info("shutting down", slog.Duration("timeout", app.cfg.Server.ShutdownTimeout))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), app.cfg.Server.ShutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return errors.Join(err, app.Close())
+}
+
+// Close stops background work and closes the session store, Redis and
+// MongoDB, in that order, so that nothing still in use is closed under it.
+func (app *App) Close() error {
+	app.cancel()
+
+	var errs []error
+	if app.sessionStore != nil && app.redisClient != nil {
+		if err, rediStore := redisStore.GetRedisStore(app.sessionStore.(redisStore.Store)); err != nil {
+			errs = append(errs, err)
+		} else if err := rediStore.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if app.redisClient != nil {
+		if err := app.redisClient.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if app.mongoClient != nil {
+		disconnectCtx, cancel := context.WithTimeout(context.Background(), app.cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := app.mongoClient.Disconnect(disconnectCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if app.shutdownTracing != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), app.cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := app.shutdownTracing(flushCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	slog.Info("closed connections")
+	return errors.Join(errs...)
+}
+
+// mongoMonitor passes every command event to each of monitors.
+func mongoMonitor(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// healthChecks registers a readiness check for every dependency that is
+// actually in use; in-memory stores and cookie sessions cannot fail.
+func (app *App) healthChecks() *handler.HealthHandler {
+	health := handler.NewHealthHandler(app.cfg.Server.HealthCheckTimeout)
+	if app.mongoClient != nil {
+		health.Add("mongo", func(ctx context.Context) error {
+			return app.mongoClient.Ping(ctx, readpref.Primary())
+		})
+	}
+	if app.redisClient != nil {
+		health.Add("redis", func(ctx context.Context) error {
+			return app.redisClient.WithContext(ctx).Ping().Err()
+		})
+	}
+	if store, ok := app.sessionStore.(redisStore.Store); ok {
+		health.Add("sessions", func(ctx context.Context) error {
+			err, rediStore := redisStore.GetRedisStore(store)
+			if err != nil {
+				return err
+			}
+			conn, err := rediStore.Pool.GetContext(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			_, err = conn.Do("PING")
+			return err
+		})
+	}
+	for _, authenticator := range app.authenticators {
+		if oidc, ok := authenticator.(*handler.OIDCAuthenticator); ok {
+			health.Add("jwks", handler.KeySetCheck(oidc.KeySet()))
+		}
+	}
+	return health
+}
+
+// rateLimit limits the named route group with its configured quota.
+func (app *App) rateLimit(group string) gin.HandlerFunc {
+	return handler.RateLimit(app.rateLimiter, group, app.quotas[group])
+}
+
+// reloadOnHangup re-reads the signing keys on SIGHUP so that keys can be
+// rotated without a restart.
+func (app *App) reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-hangup:
+			if err := app.keyRing.Reload(); err != nil {
+				slog.Error("reload JWT signing keys failed", slog.Any("error", err))
+				continue
+			}
+			slog.Info("reloaded JWT signing keys")
+		}
+	}
+}
+
+func (app *App) IndexHandler(c *gin.Context) {
+
+	c.HTML(http.StatusOK, "index.tmpl", gin.H{
+		"recipes": app.staticRecipes,
+	})
+}
+
+func (app *App) RecipeHandler(c *gin.Context) {
+	for _, recipe := range app.staticRecipes {
+		if recipe.ID == c.Param("id") {
+			c.HTML(http.StatusOK, "recipe.tmpl", gin.H{
+				"recipe": recipe,
+			})
+			return
+
+		}
+	}
+	c.File("404.html")
+}
+
+// RecipeByIDHandler serves the HTML recipe page to browsers and the stored
+// recipe as JSON to API clients.
+func (app *App) RecipeByIDHandler(c *gin.Context) {
+	switch c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) {
+	case gin.MIMEHTML:
+		app.RecipeHandler(c)
+	default:
+		app.recipesHandler.GetRecipeHandler(c)
+	}
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores serialized values under string keys. A ttl of zero means the
+// entry never expires.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+	// Incr adds one to the counter stored at key, starting from zero, and
+	// returns the new value. Counters never expire.
+	Incr(ctx context.Context, key string) (int64, error)
+}
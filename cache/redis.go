@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+const scanCount = 100
+
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{
+		client: client,
+	}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	val, err := tracing.Redis(ctx, c.client).Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return val, err
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return tracing.Redis(ctx, c.client).Set(key, value, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return tracing.Redis(ctx, c.client).Del(keys...).Err()
+}
+
+func (c *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return tracing.Redis(ctx, c.client).Incr(key).Result()
+}
+
+// DeletePrefix walks the keyspace with SCAN rather than KEYS so that a
+// large cache does not block Redis while it is being invalidated.
+func (c *RedisCache) DeletePrefix(ctx context.Context, prefix string) error {
+	var cursor uint64
+	for {
+		keys, next, err := tracing.Redis(ctx, c.client).Scan(cursor, prefix+"*", scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if err := c.Delete(ctx, keys...); err != nil {
+			return err
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bunyawats/recipes-api/logging"
+	"github.com/bunyawats/recipes-api/ratelimit"
+	"github.com/bunyawats/recipes-api/tracing"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	StrategyAPIKey    = "api-key"
+	StrategyClientKey = "client-key"
+	StrategySession   = "session"
+	StrategyJWT       = "jwt"
+	StrategyOIDC      = "oidc"
+
+	redacted = "[REDACTED]"
+	// minSessionSecretLength matches the HMAC-SHA256 key size used to sign
+	// session cookies.
+	minSessionSecretLength = 32
+)
+
+// Config is everything the API reads at startup. It is built from Default,
+// then an optional YAML or TOML file, then the environment; see Load.
+type Config struct {
+	Server    Server    `json:"server" yaml:"server" toml:"server"`
+	Mongo     Mongo     `json:"mongo" yaml:"mongo" toml:"mongo"`
+	Redis     Redis     `json:"redis" yaml:"redis" toml:"redis"`
+	Session   Session   `json:"session" yaml:"session" toml:"session"`
+	Cache     Cache     `json:"cache" yaml:"cache" toml:"cache"`
+	Auth      Auth      `json:"auth" yaml:"auth" toml:"auth"`
+	RateLimit RateLimit `json:"rateLimit" yaml:"rateLimit" toml:"rateLimit"`
+	Log       Log       `json:"log" yaml:"log" toml:"log"`
+	Tracing   Tracing   `json:"tracing" yaml:"tracing" toml:"tracing"`
+}
+
+// Server sets the listen address and the HTTP timeouts. On SIGINT or
+// SIGTERM in-flight requests get ShutdownTimeout to complete. Each
+// readiness check is given HealthCheckTimeout. X-Forwarded-For is only
+// believed from TrustedProxies, IP addresses or CIDRs; with none, the
+// client IP used for rate limits and lockouts is the peer address.
+type Server struct {
+	Addr               string        `json:"addr" yaml:"addr" toml:"addr"`
+	ReadHeaderTimeout  time.Duration `json:"readHeaderTimeout" yaml:"readHeaderTimeout" toml:"readHeaderTimeout"`
+	ReadTimeout        time.Duration `json:"readTimeout" yaml:"readTimeout" toml:"readTimeout"`
+	WriteTimeout       time.Duration `json:"writeTimeout" yaml:"writeTimeout" toml:"writeTimeout"`
+	IdleTimeout        time.Duration `json:"idleTimeout" yaml:"idleTimeout" toml:"idleTimeout"`
+	ShutdownTimeout    time.Duration `json:"shutdownTimeout" yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+	HealthCheckTimeout time.Duration `json:"healthCheckTimeout" yaml:"healthCheckTimeout" toml:"healthCheckTimeout"`
+	TrustedProxies     []string      `json:"trustedProxies" yaml:"trustedProxies" toml:"trustedProxies"`
+}
+
+// Mongo stores recipes, users and API keys; without a URI they are kept in
+// memory.
+type Mongo struct {
+	URI      string `json:"uri" yaml:"uri" toml:"uri"`
+	Database string `json:"database" yaml:"database" toml:"database"`
+}
+
+// Redis backs the cache, tokens, sessions, sign-in attempts and rate
+// limits; without an address they are kept in memory.
+type Redis struct {
+	Addr     string `json:"addr" yaml:"addr" toml:"addr"`
+	Password string `json:"password" yaml:"password" toml:"password"`
+	DB       int    `json:"db" yaml:"db" toml:"db"`
+}
+
+type Session struct {
+	Secret string `json:"secret" yaml:"secret" toml:"secret"`
+}
+
+// Cache sets how long cached recipes and listings are served before they
+// are reloaded. When Stale is positive an expired entry is still served
+// for that long while it is refreshed in the background.
+type Cache struct {
+	Recipe time.Duration `json:"recipe" yaml:"recipe" toml:"recipe"`
+	List   time.Duration `json:"list" yaml:"list" toml:"list"`
+	Stale  time.Duration `json:"stale" yaml:"stale" toml:"stale"`
+}
+
+type Auth struct {
+	// Strategies are tried in order: api-key, client-key, session, jwt and
+	// oidc. Sessions from /signin and tokens from /token are only accepted
+	// when session and jwt are listed.
+	Strategies []string `json:"strategies" yaml:"strategies" toml:"strategies"`
+	// APIKey is the shared admin key of the api-key strategy.
+	APIKey string `json:"apiKey" yaml:"apiKey" toml:"apiKey"`
+	// JWTSecret signs HS256 tokens unless SigningKeys are given.
+	JWTSecret string `json:"jwtSecret" yaml:"jwtSecret" toml:"jwtSecret"`
+	// SigningKeys are PEM private key files, the first of which signs.
+	SigningKeys []string `json:"signingKeys" yaml:"signingKeys" toml:"signingKeys"`
+	BcryptCost  int      `json:"bcryptCost" yaml:"bcryptCost" toml:"bcryptCost"`
+	Tokens      Tokens   `json:"tokens" yaml:"tokens" toml:"tokens"`
+	OIDC        OIDC     `json:"oidc" yaml:"oidc" toml:"oidc"`
+	Lockout     Lockout  `json:"lockout" yaml:"lockout" toml:"lockout"`
+}
+
+// Tokens sets the lifetime of JWT access tokens and of the refresh tokens
+// used to renew them. Access tokens carry Issuer and Audience as their iss
+// and aud claims, and tokens naming anything else are rejected.
+type Tokens struct {
+	Access   time.Duration `json:"access" yaml:"access" toml:"access"`
+	Refresh  time.Duration `json:"refresh" yaml:"refresh" toml:"refresh"`
+	Issuer   string        `json:"issuer" yaml:"issuer" toml:"issuer"`
+	Audience string        `json:"audience" yaml:"audience" toml:"audience"`
+}
+
+// OIDC configures the oidc strategy. Issuer and JWKS default to the Auth0
+// tenant named by Domain.
+type OIDC struct {
+	Domain          string        `json:"domain" yaml:"domain" toml:"domain"`
+	Issuer          string        `json:"issuer" yaml:"issuer" toml:"issuer"`
+	Audience        string        `json:"audience" yaml:"audience" toml:"audience"`
+	JWKS            string        `json:"jwks" yaml:"jwks" toml:"jwks"`
+	RefreshInterval time.Duration `json:"refreshInterval" yaml:"refreshInterval" toml:"refreshInterval"`
+}
+
+// Lockout locks a username for Duration after Threshold failed sign-ins.
+type Lockout struct {
+	Threshold int64         `json:"threshold" yaml:"threshold" toml:"threshold"`
+	Duration  time.Duration `json:"duration" yaml:"duration" toml:"duration"`
+}
+
+// RateLimit holds per route group quotas written as requests/window, e.g.
+// 100/1m, or off.
+type RateLimit struct {
+	Public string `json:"public" yaml:"public" toml:"public"`
+	Auth   string `json:"auth" yaml:"auth" toml:"auth"`
+	API    string `json:"api" yaml:"api" toml:"api"`
+	Write  string `json:"write" yaml:"write" toml:"write"`
+}
+
+// Log selects the log line format, json or logfmt, and the minimum level:
+// debug, info, warn or error.
+type Log struct {
+	Format string `json:"format" yaml:"format" toml:"format"`
+	Level  string `json:"level" yaml:"level" toml:"level"`
+}
+
+// Tracing selects where spans are exported: none, stdout or otlp. The otlp
+// exporter posts to Endpoint, e.g. http://localhost:4318 for a local
+// collector. SampleRatio is the share of new traces that are recorded;
+// requests whose traceparent is sampled are always recorded.
+type Tracing struct {
+	Exporter    string  `json:"exporter" yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+	ServiceName string  `json:"serviceName" yaml:"serviceName" toml:"serviceName"`
+	SampleRatio float64 `json:"sampleRatio" yaml:"sampleRatio" toml:"sampleRatio"`
+}
+
+// Default returns the settings used for anything not configured.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:               ":8080",
+			ReadHeaderTimeout:  5 * time.Second,
+			ReadTimeout:        15 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			IdleTimeout:        time.Minute,
+			ShutdownTimeout:    15 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Cache: Cache{
+			Recipe: 10 * time.Minute,
+			List:   time.Minute,
+		},
+		Auth: Auth{
+			Strategies: []string{StrategyClientKey, StrategySession, StrategyJWT, StrategyOIDC},
+			BcryptCost: bcrypt.DefaultCost,
+			Tokens: Tokens{
+				Access:   5 * time.Minute,
+				Refresh:  24 * time.Hour,
+				Issuer:   "recipes-api",
+				Audience: "recipes-api",
+			},
+			OIDC: OIDC{
+				RefreshInterval: time.Hour,
+			},
+			Lockout: Lockout{
+				Threshold: 10,
+				Duration:  15 * time.Minute,
+			},
+		},
+		RateLimit: RateLimit{
+			Public: "300/1m",
+			Auth:   "30/1m",
+			API:    "600/1m",
+			Write:  "60/1m",
+		},
+		Log: Log{
+			Format: logging.FormatJSON,
+			Level:  "info",
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.ExporterNone,
+			ServiceName: "recipes-api",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Validate reports every invalid or missing setting at once.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server address is required")
+	check(c.Server.ReadHeaderTimeout > 0 && c.Server.ReadTimeout > 0 && c.Server.WriteTimeout > 0 &&
+		c.Server.IdleTimeout > 0 && c.Server.ShutdownTimeout > 0 && c.Server.HealthCheckTimeout > 0, "server timeouts must be positive")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err == nil || net.ParseIP(proxy) != nil, "trusted proxy %q is not an IP address or CIDR", proxy)
+	}
+	check(c.Mongo.URI == "" || c.Mongo.Database != "", "mongo database is required with a mongo URI")
+	check(len(c.Session.Secret) >= minSessionSecretLength,
+		"session secret must be at least %d characters", minSessionSecretLength)
+	check(c.Cache.Recipe >= 0 && c.Cache.List >= 0 && c.Cache.Stale >= 0, "cache TTLs must not be negative")
+
+	check(len(c.Auth.Strategies) > 0, "at least one authentication strategy is required")
+	for _, strategy := range c.Auth.Strategies {
+		switch strategy {
+		case StrategyAPIKey:
+			check(c.Auth.APIKey != "", "the api-key strategy requires an API key")
+		case StrategyOIDC:
+			check(c.Auth.OIDC.Issuer != "" || c.Auth.OIDC.Domain != "",
+				"the oidc strategy requires an issuer or an Auth0 domain")
+			check(c.Auth.OIDC.Audience != "", "the oidc strategy requires an audience")
+		case StrategyClientKey, StrategySession, StrategyJWT:
+		default:
+			check(false, "unknown authentication strategy %q", strategy)
+		}
+	}
+	check(c.Auth.JWTSecret != "" || len(c.Auth.SigningKeys) > 0, "a JWT secret or JWT signing keys are required")
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost,
+		"bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(c.Auth.Tokens.Access > 0 && c.Auth.Tokens.Refresh > 0, "token TTLs must be positive")
+	check(c.Auth.Tokens.Issuer != "" && c.Auth.Tokens.Audience != "", "token issuer and audience are required")
+	check(c.Auth.OIDC.RefreshInterval > 0, "JWKS refresh interval must be positive")
+	check(c.Auth.Lockout.Threshold >= 0 && c.Auth.Lockout.Duration >= 0, "lockout settings must not be negative")
+
+	if _, err := c.RateLimit.Quotas(); err != nil {
+		check(false, "%s", err.Error())
+	}
+	if _, err := logging.New(io.Discard, c.Log.Format, c.Log.Level); err != nil {
+		check(false, "%s", err.Error())
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		check(false, "unknown trace exporter %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.ServiceName != "", "tracing service name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "trace sample ratio must be between 0 and 1")
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Quotas parses the rate limits by route group name.
+func (r RateLimit) Quotas() (map[string]ratelimit.Quota, error) {
+	quotas := make(map[string]ratelimit.Quota, 4)
+	for group, value := range map[string]string{
+		"public": r.Public,
+		"auth":   r.Auth,
+		"api":    r.API,
+		"write":  r.Write,
+	} {
+		quota, err := ratelimit.ParseQuota(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s rate limit: %w", group, err)
+		}
+		quotas[group] = quota
+	}
+	return quotas, nil
+}
+
+// Redacted returns a copy that is safe to log: secrets are masked and
+// passwords are removed from connection URIs.
+func (c Config) Redacted() Config {
+	c.Redis.Password = redact(c.Redis.Password)
+	c.Session.Secret = redact(c.Session.Secret)
+	c.Auth.APIKey = redact(c.Auth.APIKey)
+	c.Auth.JWTSecret = redact(c.Auth.JWTSecret)
+	if u, err := url.Parse(c.Mongo.URI); err == nil {
+		c.Mongo.URI = u.Redacted()
+	} else {
+		c.Mongo.URI = redact(c.Mongo.URI)
+	}
+	return c
+}
+
+// String renders the redacted configuration, so that printing a Config
+// never leaks secrets.
+func (c Config) String() string {
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
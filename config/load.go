@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnv names the optional YAML (.yaml, .yml) or TOML (.toml) file read
+// before the environment.
+const FileEnv = "CONFIG_FILE"
+
+// Load builds the configuration from Default, the file named by CONFIG_FILE
+// if any, and then the environment variables below, each taking precedence
+// over the previous source. The result is validated.
+func Load() (Config, error) {
+	cfg := Default()
+	if path := os.Getenv(FileEnv); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if err := loadEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, cfg)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), cfg)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown keys %v", meta.Undecoded())
+		}
+	default:
+		return fmt.Errorf("%s: config file must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	env := envReader{}
+	// PORT is what gin's Run used before ADDR existed
+	if port, ok := env.lookup("PORT"); ok {
+		cfg.Server.Addr = ":" + port
+	}
+	env.string("ADDR", &cfg.Server.Addr)
+	env.duration("READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	env.duration("READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	env.duration("WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	env.duration("IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	env.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	env.duration("HEALTH_CHECK_TIMEOUT", &cfg.Server.HealthCheckTimeout)
+	env.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	env.string("MONGO_URI", &cfg.Mongo.URI)
+	env.string("MONGO_DATABASE", &cfg.Mongo.Database)
+	env.string("REDIS_URI", &cfg.Redis.Addr)
+	env.string("REDIS_PASSWORD", &cfg.Redis.Password)
+	env.int("REDIS_DB", &cfg.Redis.DB)
+	env.string("SESSION_SECRET", &cfg.Session.Secret)
+
+	env.duration("RECIPE_CACHE_TTL", &cfg.Cache.Recipe)
+	env.duration("LIST_CACHE_TTL", &cfg.Cache.List)
+	env.duration("STALE_CACHE_TTL", &cfg.Cache.Stale)
+
+	env.list("AUTH_STRATEGIES", &cfg.Auth.Strategies)
+	env.string("X_API_KEY", &cfg.Auth.APIKey)
+	env.string("JWT_SECRET", &cfg.Auth.JWTSecret)
+	env.list("JWT_SIGNING_KEYS", &cfg.Auth.SigningKeys)
+	env.int("BCRYPT_COST", &cfg.Auth.BcryptCost)
+	env.duration("ACCESS_TOKEN_TTL", &cfg.Auth.Tokens.Access)
+	env.duration("REFRESH_TOKEN_TTL", &cfg.Auth.Tokens.Refresh)
+	env.string("TOKEN_ISSUER", &cfg.Auth.Tokens.Issuer)
+	env.string("TOKEN_AUDIENCE", &cfg.Auth.Tokens.Audience)
+	env.string("AUTH0_DOMAIN", &cfg.Auth.OIDC.Domain)
+	env.string("AUTH0_API_IDENTIFIER", &cfg.Auth.OIDC.Audience)
+	env.string("OIDC_ISSUER", &cfg.Auth.OIDC.Issuer)
+	env.string("OIDC_JWKS", &cfg.Auth.OIDC.JWKS)
+	env.duration("JWKS_REFRESH_INTERVAL", &cfg.Auth.OIDC.RefreshInterval)
+	env.int64("LOCKOUT_THRESHOLD", &cfg.Auth.Lockout.Threshold)
+	env.duration("LOCKOUT_DURATION", &cfg.Auth.Lockout.Duration)
+
+	env.string("RATE_LIMIT_PUBLIC", &cfg.RateLimit.Public)
+	env.string("RATE_LIMIT_AUTH", &cfg.RateLimit.Auth)
+	env.string("RATE_LIMIT_API", &cfg.RateLimit.API)
+	env.string("RATE_LIMIT_WRITE", &cfg.RateLimit.Write)
+
+	env.string("LOG_FORMAT", &cfg.Log.Format)
+	env.string("LOG_LEVEL", &cfg.Log.Level)
+
+	env.string("OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter)
+	env.string("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Tracing.Endpoint)
+	env.string("OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	env.float64("OTEL_TRACES_SAMPLER_ARG", &cfg.Tracing.SampleRatio)
+	return env.err
+}
+
+// envReader overrides settings with the environment variables that are
+// set, keeping the first parse error.
+type envReader struct {
+	err error
+}
+
+func (r *envReader) lookup(name string) (string, bool) {
+	value, ok := os.LookupEnv(name)
+	return value, ok && value != "" && r.err == nil
+}
+
+func (r *envReader) fail(name string, err error) {
+	r.err = fmt.Errorf("invalid %s: %w", name, err)
+}
+
+func (r *envReader) string(name string, dest *string) {
+	if value, ok := r.lookup(name); ok {
+		*dest = value
+	}
+}
+
+// list reads comma separated values, ignoring spaces.
+func (r *envReader) list(name string, dest *[]string) {
+	if value, ok := r.lookup(name); ok {
+		*dest = strings.Split(strings.ReplaceAll(value, " ", ""), ",")
+	}
+}
+
+func (r *envReader) int(name string, dest *int) {
+	if value, ok := r.lookup(name); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dest = n
+	}
+}
+
+func (r *envReader) int64(name string, dest *int64) {
+	if value, ok := r.lookup(name); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dest = n
+	}
+}
+
+func (r *envReader) float64(name string, dest *float64) {
+	if value, ok := r.lookup(name); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dest = f
+	}
+}
+
+// duration reads time.ParseDuration values such as "30s".
+func (r *envReader) duration(name string, dest *time.Duration) {
+	if value, ok := r.lookup(name); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dest = d
+	}
+}
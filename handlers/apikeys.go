@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bunyawats/recipes-api/logging"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	clientKeyPrefix = "rak_"
+	// keyPrefixLength is how much of a key is kept in clear text so that
+	// owners can tell their keys apart.
+	keyPrefixLength = len(clientKeyPrefix) + 8
+	// lastUsedInterval limits how often LastUsedAt is written for a busy key.
+	lastUsedInterval = time.Minute
+)
+
+type APIKeysHandler struct {
+	keys store.APIKeyStore
+	ctx  context.Context
+}
+
+type APIKeyInput struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// APIKeyOutput is returned once, when a key is issued. Key is not stored
+// and cannot be retrieved later.
+type APIKeyOutput struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+func NewAPIKeysHandler(ctx context.Context, keys store.APIKeyStore) *APIKeysHandler {
+	return &APIKeysHandler{
+		keys: keys,
+		ctx:  ctx,
+	}
+}
+
+// swagger:operation GET /keys keys listKeys
+// Returns the caller's API keys, or with owner every key of that user for
+// admins
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: owner
+//     in: query
+//     description: username whose keys are listed, admins only
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+func (handler *APIKeysHandler) ListAPIKeysHandler(c *gin.Context) {
+	owner := CurrentUser(c)
+	if HasRole(c, models.RoleAdmin) {
+		owner = c.Query("owner")
+	}
+	keys, err := handler.keys.List(c.Request.Context(), owner)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// swagger:operation POST /keys keys newKey
+// Issue an API key owned by the caller
+// ---
+// produces:
+// - application/json
+// responses:
+//     '201':
+//         description: Key issued, the key itself is only shown in this response
+//     '400':
+//         description: Invalid input
+//     '403':
+//         description: Caller may not grant the requested scopes
+func (handler *APIKeysHandler) NewAPIKeyHandler(c *gin.Context) {
+	if !handler.authorizeManagement(c) {
+		return
+	}
+
+	// validate request
+	var input APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput(err))
+		return
+	}
+	if err := validateScopes(input.Scopes); err != nil {
+		abortWithError(c, badRequest(err.Error()))
+		return
+	}
+	now := time.Now()
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(now) {
+		abortWithError(c, badRequest("expiresAt must be in the future"))
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !mayGrantScope(c, scope) {
+			abortWithError(c, forbidden("Insufficient role to grant scope "+scope))
+			return
+		}
+	}
+
+	// insert to database
+	secret, err := newOpaqueToken()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	rawKey := clientKeyPrefix + secret
+	key := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		Name:      input.Name,
+		Owner:     CurrentUser(c),
+		Prefix:    rawKey[:keyPrefixLength],
+		Hash:      hashAPIKey(rawKey),
+		Scopes:    input.Scopes,
+		CreatedAt: now,
+		ExpiresAt: input.ExpiresAt,
+	}
+	if err := handler.keys.Create(c.Request.Context(), &key); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIKeyOutput{
+		APIKey: key,
+		Key:    rawKey,
+	})
+}
+
+// swagger:operation GET /keys/{id} keys oneKey
+// Get one API key
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: id
+//     in: path
+//     description: ID of the key
+//     required: true
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: Invalid key ID
+func (handler *APIKeysHandler) GetAPIKeyHandler(c *gin.Context) {
+	key, ok := handler.authorizeOwner(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// swagger:operation DELETE /keys/{id} keys revokeKey
+// Revoke an API key
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: id
+//     in: path
+//     description: ID of the key
+//     required: true
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: Invalid key ID
+func (handler *APIKeysHandler) DeleteAPIKeyHandler(c *gin.Context) {
+	if !handler.authorizeManagement(c) {
+		return
+	}
+	id := c.Param("id")
+	if _, ok := handler.authorizeOwner(c, id); !ok {
+		return
+	}
+
+	err := handler.keys.Delete(c.Request.Context(), id)
+	if err == store.ErrAPIKeyNotFound {
+		abortWithError(c, notFound("API key not found"))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key has been revoked",
+	})
+}
+
+// authorizeManagement keeps API keys from issuing or revoking keys, so a
+// leaked key cannot be used to mint longer lived ones.
+func (handler *APIKeysHandler) authorizeManagement(c *gin.Context) bool {
+	if principal := CurrentPrincipal(c); principal != nil && principal.Method == StrategyClientKey {
+		abortWithError(c, forbidden("API keys cannot manage API keys"))
+		return false
+	}
+	return true
+}
+
+// authorizeOwner loads the key when the caller owns it or is an admin. Keys
+// of other users are reported as missing rather than forbidden.
+func (handler *APIKeysHandler) authorizeOwner(c *gin.Context, id string) (models.APIKey, bool) {
+	key, err := handler.keys.Get(c.Request.Context(), id)
+	if err == nil && key.Owner != CurrentUser(c) && !HasRole(c, models.RoleAdmin) {
+		err = store.ErrAPIKeyNotFound
+	}
+	if err == store.ErrAPIKeyNotFound {
+		abortWithError(c, notFound("API key not found"))
+		return key, false
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return key, false
+	}
+	return key, true
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case models.ScopeRead, models.ScopeWrite, models.ScopeAdmin:
+		default:
+			return errors.New("scopes must be read, write or admin")
+		}
+	}
+	return nil
+}
+
+// mayGrantScope keeps callers from issuing keys more powerful than
+// themselves.
+func mayGrantScope(c *gin.Context, scope string) bool {
+	var roles []string
+	if principal := CurrentPrincipal(c); principal != nil {
+		roles = principal.Roles
+	}
+	return rolesAllowScope(roles, scope)
+}
+
+// rolesAllowScope reports whether a holder of roles may grant scope.
+func rolesAllowScope(roles []string, scope string) bool {
+	switch scope {
+	case models.ScopeRead:
+		return true
+	case models.ScopeWrite:
+		return slices.Contains(roles, models.RoleAdmin) || slices.Contains(roles, models.RoleEditor)
+	}
+	return slices.Contains(roles, models.RoleAdmin)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientKeyAuthenticator accepts per-client keys issued by NewAPIKeyHandler
+// in the X-API-KEY header. The caller acts as the key's owner with the roles
+// matching the key's scopes, less any scope the owner could no longer grant.
+// Keys of disabled owners are refused; owners unknown to the user store,
+// such as OIDC users, are not checked.
+type ClientKeyAuthenticator struct {
+	keys  store.APIKeyStore
+	users store.UserStore
+}
+
+func NewClientKeyAuthenticator(keys store.APIKeyStore, users store.UserStore) *ClientKeyAuthenticator {
+	return &ClientKeyAuthenticator{
+		keys:  keys,
+		users: users,
+	}
+}
+
+func (a *ClientKeyAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	rawKey := c.GetHeader(apiKeyHeader)
+	if rawKey == "" {
+		return nil, ErrNoCredentials
+	}
+	ctx := c.Request.Context()
+	key, err := a.keys.FindByHash(ctx, hashAPIKey(rawKey))
+	if err == store.ErrAPIKeyNotFound {
+		return nil, errors.New("invalid API key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCredentialStore, err)
+	}
+	now := time.Now()
+	if key.Expired(now) {
+		return nil, errors.New("API key has expired")
+	}
+	owner, err := a.users.FindByUsername(ctx, key.Owner)
+	if err != nil && err != store.ErrUserNotFound {
+		return nil, fmt.Errorf("%w: %w", errCredentialStore, err)
+	}
+	if owner.Disabled {
+		return nil, errDisabled
+	}
+	if err == nil {
+		key.Scopes = slices.DeleteFunc(slices.Clone(key.Scopes), func(scope string) bool {
+			return !rolesAllowScope(owner.RolesOrDefault(), scope)
+		})
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		if err := a.keys.Touch(ctx, key.ID.Hex(), now); err != nil {
+			logging.FromContext(ctx).Warn("recording API key use failed", slog.String("keyId", key.ID.Hex()), slog.Any("error", err))
+		}
+	}
+	return &Principal{
+		Username: key.Owner,
+		Roles:    key.Roles(),
+		Method:   StrategyClientKey,
+		KeyID:    key.ID.Hex(),
+	}, nil
+}
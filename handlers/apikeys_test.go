@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientKeyRolesFollowOwner(t *testing.T) {
+	scopes := []string{models.ScopeRead, models.ScopeWrite, models.ScopeAdmin}
+	tests := []struct {
+		name  string
+		owner *models.User
+		roles []string
+		err   error
+	}{
+		{"admin owner", &models.User{Username: "owner", Roles: []string{models.RoleAdmin}}, []string{models.RoleViewer, models.RoleEditor, models.RoleAdmin}, nil},
+		{"owner demoted to editor", &models.User{Username: "owner", Roles: []string{models.RoleEditor}}, []string{models.RoleViewer, models.RoleEditor}, nil},
+		{"owner demoted to viewer", &models.User{Username: "owner", Roles: []string{models.RoleViewer}}, []string{models.RoleViewer}, nil},
+		{"disabled owner", &models.User{Username: "owner", Roles: []string{models.RoleAdmin}, Disabled: true}, nil, errDisabled},
+		{"owner outside the user store", nil, []string{models.RoleViewer, models.RoleEditor, models.RoleAdmin}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := store.NewMemoryUserStore()
+			if tt.owner != nil {
+				users = store.NewMemoryUserStore(*tt.owner)
+			}
+			keys := store.NewMemoryAPIKeyStore()
+			err := keys.Create(context.Background(), &models.APIKey{
+				ID:     primitive.NewObjectID(),
+				Owner:  "owner",
+				Hash:   hashAPIKey("rak_secret"),
+				Scopes: scopes,
+			})
+			if err != nil {
+				t.Fatalf("create key: %v", err)
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/recipes", nil)
+			c.Request.Header.Set(apiKeyHeader, "rak_secret")
+			principal, err := NewClientKeyAuthenticator(keys, users).Authenticate(c)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(principal.Roles, tt.roles) {
+				t.Errorf("roles = %v, want %v", principal.Roles, tt.roles)
+			}
+		})
+	}
+}
@@ -2,112 +2,158 @@ package handlers
 
 import (
 	"context"
-	"fmt"
-	"github.com/auth0-community/go-auth0"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/bunyawats/recipes-api/metrics"
 	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/bunyawats/recipes-api/tracing"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/xid"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
-	"gopkg.in/square/go-jose.v2"
 	"net/http"
-	"os"
 	"time"
 )
 
 const (
-	jwtSecretKey = "JWT_SECRET"
-	authorKey    = "Authorization"
+	authorKey = "Authorization"
+
+	// sessionCookieMaxAge is how long gin-contrib/sessions keeps a cookie
+	// session by default.
+	sessionCookieMaxAge = 30 * 24 * time.Hour
 )
 
 type AuthHandler struct {
-	collection *mongo.Collection
-	ctx        context.Context
+	users    store.UserStore
+	tokens   store.TokenStore
+	keys     *KeyRing
+	throttle *LoginThrottle
+	ctx      context.Context
+	config   config.Auth
 }
 
 type Claims struct {
-	Username string `json:"username"`
+	Username  string   `json:"username"`
+	Roles     []string `json:"roles"`
+	SessionID string   `json:"sid"`
 	jwt.StandardClaims
 }
 
 type JWTOutput struct {
-	Token   string    `json:"token"`
-	Expires time.Time `json:"expires"`
+	Token          string    `json:"token"`
+	Expires        time.Time `json:"expires"`
+	RefreshToken   string    `json:"refreshToken"`
+	RefreshExpires time.Time `json:"refreshExpires"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
-func NewAuthHandler(ctx context.Context, collection *mongo.Collection) *AuthHandler {
+func NewAuthHandler(
+	ctx context.Context,
+	cfg config.Auth,
+	users store.UserStore,
+	tokens store.TokenStore,
+	keys *KeyRing,
+	throttle *LoginThrottle,
+) *AuthHandler {
 	return &AuthHandler{
-		collection: collection,
-		ctx:        ctx,
+		users:    users,
+		tokens:   tokens,
+		keys:     keys,
+		throttle: throttle,
+		ctx:      ctx,
+		config:   cfg,
 	}
 }
 
+// authenticate checks the submitted credentials against the stored bcrypt
+// hash. Repeated failures for a username or client IP are throttled. On
+// failure it writes the error response and returns false. Every outcome is
+// counted under method, the kind of session being signed in to.
+func (handler *AuthHandler) authenticate(c *gin.Context, method string, user models.User) (models.User, bool) {
+	if !handler.throttle.allow(c, user.Username) {
+		metrics.SignIns.WithLabelValues(method, "throttled").Inc()
+		return models.User{}, false
+	}
+	foundUser, err := handler.users.FindByUsername(c.Request.Context(), user.Username)
+	if err == nil {
+		_, span := tracing.Start(c.Request.Context(), "bcrypt.compare")
+		err = bcrypt.CompareHashAndPassword(
+			[]byte(foundUser.Password),
+			[]byte(user.Password),
+		)
+		span.End()
+	}
+	if err == store.ErrUserNotFound || err == bcrypt.ErrMismatchedHashAndPassword {
+		metrics.SignIns.WithLabelValues(method, "failure").Inc()
+		if err := handler.throttle.fail(c, user.Username); err != nil {
+			abortWithError(c, err)
+			return foundUser, false
+		}
+		abortWithError(c, unauthorized("Invalid username or password"))
+		return foundUser, false
+	}
+	if err == nil {
+		err = handler.throttle.succeed(c.Request.Context(), user.Username)
+	}
+	if err != nil {
+		metrics.SignIns.WithLabelValues(method, "error").Inc()
+		abortWithError(c, err)
+		return foundUser, false
+	}
+	if foundUser.Disabled {
+		metrics.SignIns.WithLabelValues(method, "disabled").Inc()
+		abortWithError(c, forbidden("Account is disabled"))
+		return foundUser, false
+	}
+	metrics.SignIns.WithLabelValues(method, "success").Inc()
+	return foundUser, true
+}
+
+// swagger:operation POST /token auth token
+// Login with username and password for a JWT access token and a refresh
+// token
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+//     '400':
+//         description: Invalid input
+//     '401':
+//         description: Invalid credentials
+//     '403':
+//         description: Account is disabled
+//     '429':
+//         description: Too many failed attempts, retry after Retry-After seconds
 func (handler *AuthHandler) SignInForJwtHandler(c *gin.Context) {
 
 	// validate request
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, invalidInput(err))
 		return
 	}
 
-	// find user by username
-	cur := handler.collection.FindOne(
-		handler.ctx,
-		bson.M{
-			"username": user.Username,
-		},
-	)
-	if cur.Err() != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid username or password",
-		})
+	// find user and compare hash and password
+	foundUser, ok := handler.authenticate(c, StrategyJWT, user)
+	if !ok {
 		return
 	}
+	metrics.Sessions.WithLabelValues(StrategyJWT, "started").Inc()
 
-	// compare hash and password
-	var foundUser models.User
-	cur.Decode(&foundUser)
-	fmt.Println("foundUser", foundUser)
-	byteHash := []byte(foundUser.Password)
-	bytePlainPwd := []byte(user.Password)
-	err := bcrypt.CompareHashAndPassword(byteHash, bytePlainPwd)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid username or password",
-		})
-		return
-	}
-
-	// create jwt token
-	expirationTime := time.Now().Add(10 * time.Minute)
-	claims := &Claims{
-		Username: user.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv(jwtSecretKey)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-		return
-	}
-	jwtOutput := JWTOutput{
-		Token:   tokenString,
-		Expires: expirationTime,
-	}
-
-	c.JSON(http.StatusOK, jwtOutput)
-
+	// create jwt and refresh tokens
+	handler.issueTokens(c, store.RefreshToken{
+		Username:  user.Username,
+		Roles:     foundUser.RolesOrDefault(),
+		SessionID: xid.New().String(),
+	})
 }
 
 // swagger:operation POST /signin auth signIn
@@ -120,48 +166,33 @@ func (handler *AuthHandler) SignInForJwtHandler(c *gin.Context) {
 //         description: Successful operation
 //     '401':
 //         description: Invalid credentials
+//     '429':
+//         description: Too many failed attempts, retry after Retry-After seconds
 func (handler *AuthHandler) SignInHandler(c *gin.Context) {
 
 	// validate request
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, invalidInput(err))
 		return
 	}
 
-	// find user by username
-	cur := handler.collection.FindOne(
-		handler.ctx,
-		bson.M{
-			"username": user.Username,
-		},
-	)
-	if cur.Err() != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid username or password",
-		})
+	// find user and compare hash and password
+	foundUser, ok := handler.authenticate(c, StrategySession, user)
+	if !ok {
 		return
 	}
+	metrics.Sessions.WithLabelValues(StrategySession, "started").Inc()
 
-	// compare hash and password
-	var foundUser models.User
-	cur.Decode(&foundUser)
-	fmt.Println("foundUser", foundUser)
-	byteHash := []byte(foundUser.Password)
-	bytePlainPwd := []byte(user.Password)
-	err := bcrypt.CompareHashAndPassword(byteHash, bytePlainPwd)
+	sessionToken := xid.New().String()
+	err := handler.tokens.TrackSession(c.Request.Context(), user.Username, sessionToken, handler.sessionLifetime())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid username or password",
-		})
+		abortWithError(c, err)
 		return
 	}
-
-	sessionToken := xid.New().String()
 	session := sessions.Default(c)
 	session.Set("username", user.Username)
+	session.Set("roles", foundUser.RolesOrDefault())
 	session.Set("token", sessionToken)
 	session.Save()
 
@@ -171,144 +202,177 @@ func (handler *AuthHandler) SignInHandler(c *gin.Context) {
 }
 
 // swagger:operation POST /signout auth signOut
-// Signing out
+// Signing out, revoking every token issued since sign in
 // ---
 // responses:
 //     '200':
 //         description: Successful operation
 func (handler *AuthHandler) SignOutHandler(c *gin.Context) {
 	session := sessions.Default(c)
+	if session.Get("token") != nil {
+		metrics.Sessions.WithLabelValues(StrategySession, "ended").Inc()
+	}
 	session.Clear()
 	session.Save()
+
+	// the access token, or failing that the refresh token, identifies the
+	// JWT session to revoke
+	var sessionID string
+	claims, err := handler.keys.ParseClaims(bearerToken(c))
+	if err == nil {
+		sessionID = claims.SessionID
+	} else {
+		var input RefreshInput
+		if c.ShouldBindJSON(&input) == nil {
+			data, _ := handler.tokens.ConsumeRefreshToken(c.Request.Context(), input.RefreshToken)
+			sessionID = data.SessionID
+		}
+	}
+	if sessionID != "" {
+		if err := handler.tokens.RevokeSession(c.Request.Context(), sessionID, handler.config.Tokens.Refresh); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		metrics.Sessions.WithLabelValues(StrategyJWT, "ended").Inc()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Signed out...",
 	})
 }
 
 // swagger:operation POST /refresh auth refresh
-// Refresh token
+// Exchange a refresh token for a new access and refresh token
 // ---
 // produces:
 // - application/json
 // responses:
 //     '200':
 //         description: Successful operation
+//     '400':
+//         description: Missing refresh token
 //     '401':
-//         description: Invalid credentials
+//         description: Invalid, expired, reused or revoked refresh token
 func (handler *AuthHandler) RefreshHandler(c *gin.Context) {
-	tokenValue := c.GetHeader(authorKey)
-	claims := &Claims{}
-	tkn, err := jwt.ParseWithClaims(
-		tokenValue,
-		claims,
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv(jwtSecretKey)), nil
-		},
-	)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": err.Error(),
-		})
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput(err))
 		return
 	}
-	if tkn == nil || !tkn.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid token",
-		})
+
+	data, err := handler.tokens.ConsumeRefreshToken(c.Request.Context(), input.RefreshToken)
+	if err == store.ErrTokenReused {
+		// a used token showing up again means it leaked, so nothing
+		// issued to this session can be trusted any more
+		handler.tokens.RevokeSession(c.Request.Context(), data.SessionID, handler.config.Tokens.Refresh)
+	}
+	if err == store.ErrTokenNotFound || err == store.ErrTokenReused {
+		abortWithError(c, unauthorized("Invalid refresh token"))
 		return
 	}
-	if time.Unix(claims.ExpiresAt, 0).Sub(time.Now()) > 30*time.Second {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Token is not expired yet",
-		})
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	expirationTime := time.Now().Add(5 * time.Minute)
-	claims.ExpiresAt = expirationTime.Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	jwtSecret := os.Getenv(jwtSecretKey)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	revoked, err := handler.tokens.IsSessionRevoked(c.Request.Context(), data.SessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, err)
+		return
+	}
+	if revoked {
+		abortWithError(c, unauthorized("Session has been revoked"))
 		return
 	}
 
-	jwtOutput := JWTOutput{
-		Token:   tokenString,
-		Expires: expirationTime,
+	// the account may have been disabled or removed since sign in
+	user, err := handler.users.FindByUsername(c.Request.Context(), data.Username)
+	if err == nil && user.Disabled {
+		err = errDisabled
 	}
-	c.JSON(http.StatusOK, jwtOutput)
+	if err == store.ErrUserNotFound || err == errDisabled {
+		handler.tokens.RevokeSession(c.Request.Context(), data.SessionID, handler.config.Tokens.Refresh)
+		abortWithError(c, unauthorized("Invalid refresh token").WithCause(err))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// roles may have changed since sign in, the new tokens carry the
+	// current ones
+	data.Roles = user.RolesOrDefault()
+	handler.issueTokens(c, data)
 }
 
-func AuthJwtMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tokenValue := c.GetHeader(authorKey)
-		claims := &Claims{}
-		tkn, err := jwt.ParseWithClaims(
-			tokenValue,
-			claims,
-			func(token *jwt.Token) (interface{}, error) {
-				return []byte(os.Getenv(jwtSecretKey)), nil
-			},
-		)
-		if err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
-		if tkn == nil || !tkn.Valid {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
-		c.Next()
+// issueTokens signs a new access token and stores a new refresh token for
+// the session, then writes both to the response.
+func (handler *AuthHandler) issueTokens(c *gin.Context, data store.RefreshToken) {
+	err := handler.tokens.TrackSession(c.Request.Context(), data.Username, data.SessionID, handler.sessionLifetime())
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-}
 
-func AuthSessionMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		sessionToken := session.Get("token")
-		if sessionToken == nil {
-			c.JSON(http.StatusForbidden, gin.H{
-				"message": "Not logged",
-			})
-			c.Abort()
-		}
-		c.Next()
+	now := time.Now()
+	expirationTime := now.Add(handler.config.Tokens.Access)
+	claims := &Claims{
+		Username:  data.Username,
+		Roles:     data.Roles,
+		SessionID: data.SessionID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        xid.New().String(),
+			Issuer:    handler.config.Tokens.Issuer,
+			Audience:  handler.config.Tokens.Audience,
+			Subject:   data.Username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+	tokenString, err := handler.keys.Sign(claims)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-}
 
-func (handler *AuthHandler) AuthMiddleware() gin.HandlerFunc {
+	refreshToken, err := newOpaqueToken()
+	if err == nil {
+		err = handler.tokens.SaveRefreshToken(c.Request.Context(), refreshToken, data, handler.config.Tokens.Refresh)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
 
-	auth0DomainName := os.Getenv("AUTH0_DOMAIN")
-	auth0ApiIdentifier := os.Getenv("AUTH0_API_IDENTIFIER")
+	jwtOutput := JWTOutput{
+		Token:          tokenString,
+		Expires:        expirationTime,
+		RefreshToken:   refreshToken,
+		RefreshExpires: now.Add(handler.config.Tokens.Refresh),
+	}
+	c.JSON(http.StatusOK, jwtOutput)
+}
 
-	fmt.Println("auth0DomainName", auth0DomainName)
-	fmt.Println("auth0ApiIdentifier", auth0ApiIdentifier)
+// sessionLifetime is how long a session may stay usable, and so how long
+// its revocation must be remembered.
+func (handler *AuthHandler) sessionLifetime() time.Duration {
+	if handler.config.Tokens.Refresh > sessionCookieMaxAge {
+		return handler.config.Tokens.Refresh
+	}
+	return sessionCookieMaxAge
+}
 
-	return func(c *gin.Context) {
-		var auth0Domain = "https://" + auth0DomainName + "/"
-		client := auth0.NewJWKClient(
-			auth0.JWKClientOptions{
-				URI: auth0Domain + ".well-known/jwks.json",
-			},
-			nil,
-		)
+// revokeUserSessions signs username out everywhere except from the session
+// keep, which may be empty.
+func (handler *AuthHandler) revokeUserSessions(ctx context.Context, username string, keep string) error {
+	return handler.tokens.RevokeUserSessions(ctx, username, keep, handler.sessionLifetime())
+}
 
-		configuration := auth0.NewConfiguration(
-			client,
-			[]string{auth0ApiIdentifier},
-			auth0Domain,
-			jose.RS256)
-		validator := auth0.NewValidator(configuration, nil)
-		_, err := validator.ValidateRequest(c.Request)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"message": err.Error(),
-			})
-			c.Abort()
-			return
-		}
-		c.Next()
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
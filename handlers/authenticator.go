@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/auth0-community/go-auth0"
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/square/go-jose.v2"
+	joseJwt "gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"strings"
+)
+
+const (
+	principalKey = "principal"
+	apiKeyHeader = "X-API-KEY"
+
+	StrategyAPIKey    = config.StrategyAPIKey
+	StrategyClientKey = config.StrategyClientKey
+	StrategySession   = config.StrategySession
+	StrategyJWT       = config.StrategyJWT
+	StrategyOIDC      = config.StrategyOIDC
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does
+// not carry the kind of credentials it handles, so that the next
+// authenticator in the chain can be tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// errCredentialStore wraps failures to look credentials up, which are
+// answered as server errors rather than as invalid credentials.
+var errCredentialStore = errors.New("credential lookup failed")
+
+// errDisabled refuses credentials that belong to a disabled user.
+var errDisabled = errors.New("account is disabled")
+
+// Principal is the authenticated caller, whichever strategy recognised it.
+type Principal struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	Method   string   `json:"method"`
+	// KeyID identifies the per-client API key used, if any.
+	KeyID string `json:"keyId,omitempty"`
+	// SessionID identifies the cookie or JWT session used, if any.
+	SessionID string `json:"-"`
+}
+
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*Principal, error)
+}
+
+// NewAuthenticators builds the chain of cfg.Strategies, in the order they
+// are tried. For oidc, the issuer and JWKS default to the Auth0 tenant named
+// by the domain; the JWKS may also be a local file or a local stand-in
+// server. Key sets are refreshed in the background until ctx is done.
+func NewAuthenticators(
+	ctx context.Context,
+	cfg config.Auth,
+	jwtKeys *KeyRing,
+	tokens store.TokenStore,
+	apiKeys store.APIKeyStore,
+	users store.UserStore,
+) ([]Authenticator, error) {
+	if len(cfg.Strategies) == 0 {
+		return nil, errors.New("at least one authentication strategy is required")
+	}
+	authenticators := make([]Authenticator, 0, len(cfg.Strategies))
+	for _, strategy := range cfg.Strategies {
+		switch strategy {
+		case StrategyAPIKey:
+			if cfg.APIKey == "" {
+				return nil, errors.New("api-key authentication requires an API key")
+			}
+			authenticators = append(authenticators, NewAPIKeyAuthenticator(cfg.APIKey))
+		case StrategyClientKey:
+			if apiKeys == nil || users == nil {
+				return nil, errors.New("client-key authentication requires an API key store and a user store")
+			}
+			authenticators = append(authenticators, NewClientKeyAuthenticator(apiKeys, users))
+		case StrategySession:
+			if tokens == nil {
+				return nil, errors.New("session authentication requires a token store")
+			}
+			authenticators = append(authenticators, NewSessionAuthenticator(tokens))
+		case StrategyJWT:
+			if jwtKeys == nil || tokens == nil {
+				return nil, errors.New("jwt authentication requires signing keys and a token store")
+			}
+			authenticators = append(authenticators, NewJWTAuthenticator(jwtKeys, tokens))
+		case StrategyOIDC:
+			oidc := cfg.OIDC
+			issuer := oidc.Issuer
+			if issuer == "" && oidc.Domain != "" {
+				issuer = "https://" + oidc.Domain + "/"
+			}
+			jwksSource := oidc.JWKS
+			if jwksSource == "" && issuer != "" {
+				jwksSource = strings.TrimSuffix(issuer, "/") + "/.well-known/jwks.json"
+			}
+			if issuer == "" || oidc.Audience == "" {
+				return nil, errors.New("oidc authentication requires an issuer or domain and an audience")
+			}
+			keySet := NewKeySet(jwksSource, nil)
+			go keySet.Start(ctx, oidc.RefreshInterval)
+			authenticators = append(authenticators, NewOIDCAuthenticator(keySet, issuer, oidc.Audience))
+		default:
+			return nil, fmt.Errorf("unknown authentication strategy %q", strategy)
+		}
+	}
+	return authenticators, nil
+}
+
+// Authenticate tries each authenticator in turn and stores the first
+// Principal it gets in the gin context. The request is rejected with 401
+// when none of them accepts it.
+func Authenticate(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := c.Request
+		ctx, span := tracing.Start(request.Context(), "authenticate")
+		c.Request = request.WithContext(ctx)
+		principal, failure := authenticate(c, authenticators)
+		c.Request = request
+		if failure == nil {
+			span.SetAttributes(attribute.String("auth.method", principal.Method))
+		}
+		tracing.End(span, failure)
+
+		if failure == nil {
+			c.Set(principalKey, principal)
+			c.Next()
+			return
+		}
+		if errors.Is(failure, errCredentialStore) {
+			abortWithError(c, failure)
+			return
+		}
+		// The failure can quote decoder or verifier messages, so clients
+		// only see why in the logs.
+		abortWithError(c, unauthorized("Invalid or missing credentials").WithCause(failure))
+	}
+}
+
+func authenticate(c *gin.Context, authenticators []Authenticator) (*Principal, error) {
+	failure := ErrNoCredentials
+	for _, authenticator := range authenticators {
+		principal, err := authenticator.Authenticate(c)
+		if err == nil {
+			return principal, nil
+		}
+		if failure == ErrNoCredentials {
+			failure = err
+		}
+	}
+	return nil, failure
+}
+
+// CurrentPrincipal returns the caller set by Authenticate, or nil for
+// anonymous requests.
+func CurrentPrincipal(c *gin.Context) *Principal {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	principal, _ := value.(*Principal)
+	return principal
+}
+
+// CurrentUser returns the username recorded by the authentication
+// middleware, or an empty string for anonymous requests.
+func CurrentUser(c *gin.Context) string {
+	if principal := CurrentPrincipal(c); principal != nil {
+		return principal.Username
+	}
+	return ""
+}
+
+// RequireRole aborts with 403 unless the caller holds at least one of the
+// given roles. It must run after an authentication middleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, role := range roles {
+			if HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+		abortWithError(c, forbidden("Insufficient role"))
+	}
+}
+
+// HasRole reports whether the authentication middleware granted role to
+// the caller.
+func HasRole(c *gin.Context, role string) bool {
+	principal := CurrentPrincipal(c)
+	if principal == nil {
+		return false
+	}
+	for _, r := range principal.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyAuthenticator accepts a single shared key sent in the X-API-KEY
+// header. Holders of the key act as an admin.
+type APIKeyAuthenticator struct {
+	key string
+}
+
+func NewAPIKeyAuthenticator(key string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		key: key,
+	}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	key := c.GetHeader(apiKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(a.key)) != 1 {
+		return nil, errors.New("invalid API key")
+	}
+	return &Principal{
+		Username: StrategyAPIKey,
+		Roles:    []string{models.RoleAdmin},
+		Method:   StrategyAPIKey,
+	}, nil
+}
+
+// SessionAuthenticator accepts the cookie session created by SignInHandler
+// unless it has been revoked. The session token doubles as its session ID.
+type SessionAuthenticator struct {
+	tokens store.TokenStore
+}
+
+func NewSessionAuthenticator(tokens store.TokenStore) *SessionAuthenticator {
+	return &SessionAuthenticator{
+		tokens: tokens,
+	}
+}
+
+func (a *SessionAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	session := sessions.Default(c)
+	token, _ := session.Get("token").(string)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	revoked, err := a.tokens.IsSessionRevoked(c.Request.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCredentialStore, err)
+	}
+	if revoked {
+		return nil, errors.New("session has been revoked")
+	}
+	principal := &Principal{
+		Method:    StrategySession,
+		SessionID: token,
+	}
+	principal.Username, _ = session.Get("username").(string)
+	principal.Roles, _ = session.Get("roles").([]string)
+	return principal, nil
+}
+
+// JWTAuthenticator accepts tokens issued by SignInForJwtHandler unless
+// their session has been revoked.
+type JWTAuthenticator struct {
+	keys   *KeyRing
+	tokens store.TokenStore
+}
+
+func NewJWTAuthenticator(keys *KeyRing, tokens store.TokenStore) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		keys:   keys,
+		tokens: tokens,
+	}
+}
+
+func (a *JWTAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	tokenValue := bearerToken(c)
+	if tokenValue == "" {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.keys.ParseClaims(tokenValue)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := a.tokens.IsSessionRevoked(c.Request.Context(), claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCredentialStore, err)
+	}
+	if revoked {
+		return nil, errors.New("token has been revoked")
+	}
+	return &Principal{
+		Username:  claims.Username,
+		Roles:     claims.Roles,
+		Method:    StrategyJWT,
+		SessionID: claims.SessionID,
+	}, nil
+}
+
+// OIDCAuthenticator accepts RS256 tokens issued by an external provider
+// such as Auth0 and verified against its cached JWKS.
+type OIDCAuthenticator struct {
+	keySet     *KeySet
+	validator  *auth0.JWTValidator
+	rolesClaim string
+}
+
+func NewOIDCAuthenticator(keySet *KeySet, issuer string, audience string) *OIDCAuthenticator {
+	configuration := auth0.NewConfiguration(
+		keySet,
+		[]string{audience},
+		issuer,
+		jose.RS256)
+	return &OIDCAuthenticator{
+		keySet:    keySet,
+		validator: auth0.NewValidator(configuration, bearerExtractor),
+		// Auth0 only passes custom claims that are namespaced, so roles are
+		// expected under the API identifier, e.g. https://api.recipes.io/roles.
+		rolesClaim: strings.TrimSuffix(audience, "/") + "/roles",
+	}
+}
+
+// KeySet exposes the cached JWKS, e.g. for readiness checks.
+func (a *OIDCAuthenticator) KeySet() *KeySet {
+	return a.keySet
+}
+
+func (a *OIDCAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	if bearerToken(c) == "" {
+		return nil, ErrNoCredentials
+	}
+	token, err := a.validator.ValidateRequest(c.Request)
+	if err != nil {
+		return nil, err
+	}
+	claims := joseJwt.Claims{}
+	customClaims := map[string]interface{}{}
+	if err := a.validator.Claims(c.Request, token, &claims, &customClaims); err != nil {
+		return nil, err
+	}
+	return &Principal{
+		Username: claims.Subject,
+		Roles:    stringSlice(customClaims[a.rolesClaim]),
+		Method:   StrategyOIDC,
+	}, nil
+}
+
+// bearerExtractor reads the token the same way bearerToken does, for use
+// by the auth0 validator.
+var bearerExtractor = auth0.RequestTokenExtractorFunc(func(r *http.Request) (*joseJwt.JSONWebToken, error) {
+	raw := stripBearer(r.Header.Get(authorKey))
+	if raw == "" {
+		return nil, auth0.ErrTokenNotFound
+	}
+	return joseJwt.ParseSigned(raw)
+})
+
+// bearerToken returns the Authorization header with any Bearer prefix
+// removed; tokens were historically sent without it.
+func bearerToken(c *gin.Context) string {
+	return stripBearer(c.GetHeader(authorKey))
+}
+
+func stripBearer(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return value
+}
+
+func stringSlice(value interface{}) []string {
+	values, _ := value.([]interface{})
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
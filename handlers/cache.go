@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bunyawats/recipes-api/cache"
+	"github.com/bunyawats/recipes-api/logging"
+	"github.com/bunyawats/recipes-api/metrics"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	recipes_key     = "recipes"
+	generationKey   = recipes_key + ":generation"
+	listKeyPrefix   = "list:"
+	cacheStatusKey  = "X-Cache"
+	cacheControlKey = "Cache-Control"
+)
+
+// CacheStats counts how recipe reads were served. Coalesced counts misses
+// that waited for a load already in flight instead of querying the store.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Stale     uint64 `json:"stale"`
+	Coalesced uint64 `json:"coalesced"`
+	Bypassed  uint64 `json:"bypassed"`
+	Errors    uint64 `json:"errors"`
+}
+
+// cacheEntry wraps cached values so that staleness can be told apart from
+// expiry: Redis keeps the key for ttl+Stale, the entry is fresh until
+// FreshUntil. A zero FreshUntil never goes stale.
+type cacheEntry struct {
+	Value      json.RawMessage `json:"value"`
+	FreshUntil time.Time       `json:"freshUntil"`
+}
+
+func (e cacheEntry) fresh() bool {
+	return e.FreshUntil.IsZero() || time.Now().Before(e.FreshUntil)
+}
+
+// CacheStats returns a snapshot of the cache counters.
+func (handler *RecipesHandler) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&handler.stats.Hits),
+		Misses:    atomic.LoadUint64(&handler.stats.Misses),
+		Stale:     atomic.LoadUint64(&handler.stats.Stale),
+		Coalesced: atomic.LoadUint64(&handler.stats.Coalesced),
+		Bypassed:  atomic.LoadUint64(&handler.stats.Bypassed),
+		Errors:    atomic.LoadUint64(&handler.stats.Errors),
+	}
+}
+
+// swagger:operation GET /cache/stats recipes cacheStats
+// Returns recipe cache counters
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+func (handler *RecipesHandler) CacheStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, handler.CacheStats())
+}
+
+// cached reads key into dest, falling back to load on a miss and storing the
+// loaded value for ttl. Concurrent misses for the same key share a single
+// load. Requests carrying Cache-Control: no-cache skip the read, no-store
+// skips both the read and the write. Cache failures are logged and served
+// from the store rather than failing the request. A shared load is not
+// cancelled when the request that started it goes away, since others may
+// be waiting on it.
+//
+// Keys are stored under the current cache generation, see invalidateCache,
+// so a load that started before a write cannot store its stale result where
+// later reads will find it.
+func (handler *RecipesHandler) cached(
+	c *gin.Context,
+	key string,
+	ttl time.Duration,
+	dest interface{},
+	load func(ctx context.Context) (interface{}, error),
+) error {
+	ctx := c.Request.Context()
+	logger := Logger(c)
+	generation, err := handler.generation(ctx)
+	if err != nil {
+		handler.count(key, "error", &handler.stats.Errors)
+		logger.Warn("cache read failed", slog.String("key", generationKey), slog.Any("error", err))
+		data, err := loadJSON(ctx, load)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, dest)
+	}
+	key = generationPrefix(generation) + key
+
+	noCache, noStore := cacheBypass(c)
+	if noCache {
+		handler.count(key, "bypass", &handler.stats.Bypassed)
+		c.Header(cacheStatusKey, "BYPASS")
+		if noStore {
+			data, err := loadJSON(ctx, load)
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(data, dest)
+		}
+	} else if entry, ok := handler.cacheRead(ctx, key); ok {
+		if entry.fresh() {
+			logger.Debug("cache hit", slog.String("key", key))
+			handler.count(key, "hit", &handler.stats.Hits)
+			c.Header(cacheStatusKey, "HIT")
+			return json.Unmarshal(entry.Value, dest)
+		}
+		if handler.cacheTTL.Stale > 0 {
+			logger.Debug("cache hit, refreshing stale entry", slog.String("key", key))
+			handler.count(key, "stale", &handler.stats.Stale)
+			c.Header(cacheStatusKey, "STALE")
+			go handler.refresh(key, ttl, load)
+			return json.Unmarshal(entry.Value, dest)
+		}
+	} else {
+		handler.count(key, "miss", &handler.stats.Misses)
+		c.Header(cacheStatusKey, "MISS")
+	}
+
+	leader := false
+	data, err, shared := handler.loads.Do(key, func() (interface{}, error) {
+		leader = true
+		return handler.loadAndStore(context.WithoutCancel(ctx), key, ttl, load)
+	})
+	if err != nil {
+		return err
+	}
+	if shared && !leader {
+		handler.count(key, "coalesced", &handler.stats.Coalesced)
+	}
+	return json.Unmarshal(data.([]byte), dest)
+}
+
+// cacheRead treats undecodable entries as misses; they are overwritten by
+// the next load.
+func (handler *RecipesHandler) cacheRead(ctx context.Context, key string) (cacheEntry, bool) {
+	var entry cacheEntry
+	val, err := handler.cache.Get(ctx, key)
+	if err == nil {
+		err = json.Unmarshal(val, &entry)
+	}
+	if err != nil {
+		if err != cache.ErrMiss {
+			handler.count(key, "error", &handler.stats.Errors)
+			logging.FromContext(ctx).Warn("cache read failed", slog.String("key", key), slog.Any("error", err))
+		}
+		return entry, false
+	}
+	return entry, true
+}
+
+// refresh reloads a stale entry in the background. It goes through the same
+// single-flight group as misses so only one refresh per key runs at a time.
+func (handler *RecipesHandler) refresh(key string, ttl time.Duration, load func(ctx context.Context) (interface{}, error)) {
+	_, err, _ := handler.loads.Do(key, func() (interface{}, error) {
+		return handler.loadAndStore(handler.ctx, key, ttl, load)
+	})
+	if err != nil {
+		logging.FromContext(handler.ctx).Error("cache refresh failed", slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+func (handler *RecipesHandler) loadAndStore(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	load func(ctx context.Context) (interface{}, error),
+) (interface{}, error) {
+	data, err := loadJSON(ctx, load)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := cacheEntry{Value: data}
+	expiry := ttl
+	if ttl > 0 {
+		entry.FreshUntil = time.Now().Add(ttl)
+		expiry += handler.cacheTTL.Stale
+	}
+	encoded, err := json.Marshal(entry)
+	if err == nil {
+		err = handler.cache.Set(ctx, key, encoded, expiry)
+	}
+	if err != nil {
+		handler.count(key, "error", &handler.stats.Errors)
+		logging.FromContext(ctx).Warn("cache write failed", slog.String("key", key), slog.Any("error", err))
+	}
+	return data, nil
+}
+
+// loadJSON traces the store query and the encoding separately, so that a
+// slow miss can be told apart from a large response.
+func loadJSON(ctx context.Context, load func(ctx context.Context) (interface{}, error)) ([]byte, error) {
+	logging.FromContext(ctx).Debug("loading from recipe store")
+	loadCtx, span := tracing.Start(ctx, "recipes.load")
+	value, err := load(loadCtx)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = tracing.Start(ctx, "json.marshal")
+	data, err := json.Marshal(value)
+	tracing.End(span, err)
+	return data, err
+}
+
+// generation returns the current cache generation, zero until the first
+// write.
+func (handler *RecipesHandler) generation(ctx context.Context) (int64, error) {
+	val, err := handler.cache.Get(ctx, generationKey)
+	if err == cache.ErrMiss {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(val), 10, 64)
+}
+
+// invalidateCache moves reads to a new cache generation and drops the
+// entries of the previous one. Must be called after the store write.
+func (handler *RecipesHandler) invalidateCache(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	generation, err := handler.cache.Incr(ctx, generationKey)
+	if err != nil {
+		logger.Warn("cache invalidation failed", slog.Any("error", err))
+		return
+	}
+	logger.Debug("invalidated cached recipes", slog.Int64("generation", generation))
+	if err := handler.cache.DeletePrefix(ctx, generationPrefix(generation-1)); err != nil {
+		logger.Warn("cache delete failed", slog.Any("error", err))
+	}
+}
+
+// count bumps a CacheStats counter together with the Prometheus counter
+// of the cache key belongs to.
+func (handler *RecipesHandler) count(key string, result string, counter *uint64) {
+	atomic.AddUint64(counter, 1)
+	metrics.CacheRequests.WithLabelValues(cacheName(key), result).Inc()
+}
+
+// cacheName tells listings apart from individual recipes.
+func cacheName(key string) string {
+	if strings.Contains(key, listKeyPrefix) {
+		return "list"
+	}
+	return "recipe"
+}
+
+func cacheBypass(c *gin.Context) (noCache bool, noStore bool) {
+	for _, directive := range strings.Split(c.GetHeader(cacheControlKey), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noCache = true
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
+
+func listKey(opts store.ListOptions) string {
+	order := opts.Sort
+	if opts.Descending {
+		order = "-" + order
+	}
+	return fmt.Sprintf(
+		"%spage=%d:size=%d:sort=%s:fields=%s",
+		listKeyPrefix,
+		opts.Page,
+		opts.Size,
+		order,
+		strings.Join(opts.Fields, ","),
+	)
+}
+
+func recipeKey(id string) string {
+	return "recipe:" + id
+}
+
+func generationPrefix(generation int64) string {
+	return recipes_key + ":" + strconv.FormatInt(generation, 10) + ":"
+}
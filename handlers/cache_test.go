@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pausingStore holds the first Get after it has read the recipe, until
+// release is closed.
+type pausingStore struct {
+	store.RecipeStore
+	paused  int32
+	loaded  chan struct{}
+	release chan struct{}
+}
+
+func (s *pausingStore) Get(ctx context.Context, id string) (models.Recipe, error) {
+	recipe, err := s.RecipeStore.Get(ctx, id)
+	if atomic.CompareAndSwapInt32(&s.paused, 0, 1) {
+		close(s.loaded)
+		<-s.release
+	}
+	return recipe, err
+}
+
+func TestCachedLoadDoesNotOutliveWrite(t *testing.T) {
+	id := primitive.NewObjectID()
+	recipes := &pausingStore{
+		RecipeStore: store.NewMemoryStore(models.Recipe{
+			ID:           id,
+			Name:         "Waffles",
+			Ingredients:  []string{"flour"},
+			Instructions: []string{"bake"},
+			Author:       "alice",
+		}),
+		loaded:  make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	router := newStoreRouter("alice", recipes)
+	get := func() models.Recipe {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/recipes/"+id.Hex(), nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("GET status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+		}
+		var recipe models.Recipe
+		if err := json.Unmarshal(recorder.Body.Bytes(), &recipe); err != nil {
+			t.Errorf("decode recipe: %v", err)
+		}
+		return recipe
+	}
+
+	// Start a read that loads the old recipe and stalls before caching it.
+	stale := make(chan models.Recipe)
+	go func() { stale <- get() }()
+	<-recipes.loaded
+
+	request := httptest.NewRequest(http.MethodPut, "/recipes/"+id.Hex(), strings.NewReader(updateBody))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	close(recipes.release)
+	if recipe := <-stale; recipe.Name != "Waffles" {
+		t.Fatalf("interleaved read = %q, want the recipe as loaded, Waffles", recipe.Name)
+	}
+	if recipe := get(); recipe.Name != "Pancakes" {
+		t.Errorf("read after write = %q, want Pancakes", recipe.Name)
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+)
+
+const problemContentType = "application/problem+json"
+
+// Codes tell clients why a request failed without parsing messages.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeTooManyAttempts  = "too_many_attempts"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// APIError is the body of every error response, rendered as an RFC 9457
+// problem document extended with a code, optional details and the request
+// ID. Its cause is logged but never sent to the client.
+type APIError struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+
+	cause error
+}
+
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{
+		Type:    "about:blank",
+		Title:   http.StatusText(status),
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.cause)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// WithDetails returns a copy of e carrying details, e.g. the failing fields
+// of a validation error.
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// WithCause returns a copy of e that logs err as the underlying reason.
+func (e *APIError) WithCause(err error) *APIError {
+	copied := *e
+	copied.cause = err
+	return &copied
+}
+
+func badRequest(message string) *APIError {
+	return NewAPIError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func unauthorized(message string) *APIError {
+	return NewAPIError(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func forbidden(message string) *APIError {
+	return NewAPIError(http.StatusForbidden, CodeForbidden, message)
+}
+
+func notFound(message string) *APIError {
+	return NewAPIError(http.StatusNotFound, CodeNotFound, message)
+}
+
+func init() {
+	// name fields in binding errors as they appear in the JSON body
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// invalidInput reports a request body that could not be bound. The decoder's
+// message names Go types, so the client only learns which field is wrong
+// and the message is kept as the logged cause.
+func invalidInput(err error) *APIError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, io.EOF):
+		return badRequest("Request body is empty").WithCause(err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("Request body is not valid JSON").WithCause(err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return badRequest("Request body has a field of the wrong type").WithDetails([]models.FieldError{{
+			Field:   typeErr.Field,
+			Code:    models.CodeInvalidType,
+			Message: "must be " + jsonType(typeErr.Type),
+		}}).WithCause(err)
+	case errors.As(err, &validationErrs):
+		fields := make([]models.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			field := models.FieldError{
+				Field:   fieldErr.Field(),
+				Code:    models.CodeInvalidFormat,
+				Message: "is invalid",
+			}
+			if fieldErr.Tag() == "required" {
+				field.Code = models.CodeRequired
+				field.Message = "is required"
+			}
+			fields = append(fields, field)
+		}
+		return badRequest("Request body has invalid fields").WithDetails(fields).WithCause(err)
+	default:
+		return badRequest("Request body is invalid").WithCause(err)
+	}
+}
+
+// jsonType describes t the way a JSON client sees it.
+func jsonType(t reflect.Type) string {
+	if t == nil {
+		return "of another type"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct, reflect.Pointer:
+		return "an object"
+	default:
+		return "of another type"
+	}
+}
+
+// toAPIError maps err onto the response a client may see. Errors the
+// handlers did not classify, including driver errors, become a generic 500
+// or, for timeouts and unreachable servers, a 503.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	var validation *models.ValidationError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &validation):
+		return NewAPIError(http.StatusUnprocessableEntity, CodeValidation, "Request failed validation").
+			WithDetails(validation.Fields).WithCause(err)
+	case errors.Is(err, store.ErrNotFound):
+		return notFound("Resource not found").WithCause(err)
+	case errors.Is(err, store.ErrInvalidID):
+		return badRequest("Invalid recipe ID").WithCause(err)
+	case mongo.IsDuplicateKeyError(err):
+		return NewAPIError(http.StatusConflict, CodeConflict, "Resource already exists").WithCause(err)
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err), mongo.IsNetworkError(err):
+		return NewAPIError(http.StatusServiceUnavailable, CodeUnavailable, "Service temporarily unavailable").WithCause(err)
+	default:
+		return NewAPIError(http.StatusInternalServerError, CodeInternal, "Internal server error").WithCause(err)
+	}
+}
+
+// abortWithError writes err as application/problem+json and stops the
+// handler chain. Server errors are logged with their cause.
+func abortWithError(c *gin.Context, err error) {
+	apiErr := toAPIError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		Logger(c).Error("request failed", slog.Int("status", apiErr.Status), slog.Any("error", apiErr))
+	} else if apiErr.cause != nil {
+		Logger(c).Info("request rejected", slog.Int("status", apiErr.Status), slog.Any("error", apiErr))
+	}
+	problem := *apiErr
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = RequestID(c)
+	body, err := json.Marshal(&problem)
+	if err != nil {
+		body = []byte(`{"status":500,"code":"internal_error"}`)
+	}
+	c.Abort()
+	c.Render(apiErr.Status, render.Data{
+		ContentType: problemContentType,
+		Data:        body,
+	})
+}
+
+// Recovery turns panics, and errors handlers attached with c.Error without
+// writing a response, into problem responses. The panic value and stack
+// are logged, not returned.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(recovered)
+				}
+				Logger(c).Error("panic recovered",
+					slog.Any("panic", recovered),
+					slog.String("stack", string(debug.Stack())),
+				)
+				if c.Writer.Written() {
+					c.Abort()
+					return
+				}
+				abortWithError(c, fmt.Errorf("panic: %v", recovered))
+			}
+		}()
+
+		c.Next()
+
+		if len(c.Errors) > 0 && !c.Writer.Written() {
+			abortWithError(c, c.Errors.Last().Err)
+		}
+	}
+}
+
+// NoRouteHandler answers unknown paths with a problem response.
+func NoRouteHandler(c *gin.Context) {
+	abortWithError(c, notFound("No route matches "+c.Request.URL.Path))
+}
+
+// NoMethodHandler answers known paths requested with an unsupported method.
+func NoMethodHandler(c *gin.Context) {
+	abortWithError(c, NewAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+		c.Request.Method+" is not allowed on "+c.Request.URL.Path))
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInvalidInputHidesDecoderErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/recipes", func(c *gin.Context) {
+		var recipe models.Recipe
+		if err := c.ShouldBindJSON(&recipe); err != nil {
+			abortWithError(c, invalidInput(err))
+		}
+	})
+	router.POST("/refresh", func(c *gin.Context) {
+		var input RefreshInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			abortWithError(c, invalidInput(err))
+		}
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		message string
+		field   string
+		code    string
+	}{
+		{"empty body", "/recipes", "", "Request body is empty", "", ""},
+		{"malformed JSON", "/recipes", `{"name":`, "Request body is not valid JSON", "", ""},
+		{"wrong type", "/recipes", `{"name":["a"]}`, "Request body has a field of the wrong type", "name", models.CodeInvalidType},
+		{"missing required field", "/refresh", `{}`, "Request body has invalid fields", "refreshToken", models.CodeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+			if body := recorder.Body.String(); strings.Contains(body, "Go struct") || strings.Contains(body, "json:") {
+				t.Errorf("body leaks the decoder error: %s", body)
+			}
+			var problem struct {
+				Message string              `json:"message"`
+				Details []models.FieldError `json:"details"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode error body: %v", err)
+			}
+			if problem.Message != tt.message {
+				t.Errorf("message = %q, want %q", problem.Message, tt.message)
+			}
+			if tt.field == "" {
+				return
+			}
+			if len(problem.Details) != 1 || problem.Details[0].Field != tt.field || problem.Details[0].Code != tt.code {
+				t.Errorf("details = %+v, want field %s with code %s", problem.Details, tt.field, tt.code)
+			}
+		})
+	}
+}
@@ -2,40 +2,40 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"github.com/bunyawats/recipes-api/cache"
+	"github.com/bunyawats/recipes-api/config"
 	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"log"
+	"golang.org/x/sync/singleflight"
 	"net/http"
 	"strings"
 	"time"
 )
 
-const recipes_key = "recipes"
-
-var recipes []models.Recipe
-var err error
-
 type RecipesHandler struct {
-	collection  *mongo.Collection
-	ctx         context.Context
-	redisClient *redis.Client
+	// stats is updated atomically and kept first for 64-bit alignment.
+	stats    CacheStats
+	store    store.RecipeStore
+	ctx      context.Context
+	cache    cache.Cache
+	cacheTTL config.Cache
+	loads    singleflight.Group
 }
 
 func NewRecipesHandler(
 	ctx context.Context,
-	collection *mongo.Collection,
-	redisClient *redis.Client,
+	cfg config.Cache,
+	recipeStore store.RecipeStore,
+	recipeCache cache.Cache,
 ) *RecipesHandler {
 	return &RecipesHandler{
-		collection,
-		ctx,
-		redisClient,
+		store:    recipeStore,
+		ctx:      ctx,
+		cache:    recipeCache,
+		cacheTTL: cfg,
 	}
 }
 
@@ -44,59 +44,51 @@ func NewRecipesHandler(
 // ---
 // produces:
 // - application/json
+// parameters:
+//   - name: page
+//     in: query
+//     description: page number starting at 1
+//     type: integer
+//   - name: size
+//     in: query
+//     description: number of recipes per page
+//     type: integer
+//   - name: sort
+//     in: query
+//     description: name or publishedAt, prefixed with - for descending order
+//     type: string
+//   - name: fields
+//     in: query
+//     description: comma separated list of fields to return
+//     type: string
 // responses:
 //     '200':
 //         description: Successful operation
+//     '400':
+//         description: Invalid input
 func (handler *RecipesHandler) ListRecipesHandler(c *gin.Context) {
 
-	val, err := handler.redisClient.Get(recipes_key).Result()
-	if err == redis.Nil {
-
-		log.Printf("Request to MongoDB")
-
-		cur, err := handler.collection.Find(handler.ctx, bson.M{})
-		if err != nil {
-			log.Println("error: ", err.Error())
-			c.JSON(http.StatusInternalServerError,
-				gin.H{
-					"error": err.Error(),
-				},
-			)
-			return
-		}
-		defer func(cur *mongo.Cursor, ctx context.Context) {
-			err := cur.Close(ctx)
-			if err != nil {
-				log.Println("error: ", err.Error())
-			}
-		}(cur, handler.ctx)
-
-		recipes := make([]models.Recipe, 0)
-		for cur.Next(handler.ctx) {
-			var recipe models.Recipe
-			_ = cur.Decode(&recipe)
-			recipes = append(recipes, recipe)
-		}
-
-		// cache to redis database
-		data, _ := json.Marshal(recipes)
-		handler.redisClient.Set(recipes_key, data, 0)
-
-		c.JSON(http.StatusOK, recipes)
-
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError,
-			gin.H{
-				"error": err.Error(),
-			})
-	} else {
-		log.Printf("Request to Redis")
-		recipes := make([]models.Recipe, 0)
-		json.Unmarshal([]byte(val), &recipes)
-
-		c.JSON(http.StatusOK, recipes)
+	opts, err := parseListOptions(c)
+	if err != nil {
+		abortWithError(c, badRequest(err.Error()))
+		return
+	}
+	var result recipePage
+	err = handler.cached(c, listKey(opts), handler.cacheTTL.List, &result, func(ctx context.Context) (interface{}, error) {
+		recipes, total, err := handler.store.List(ctx, opts)
+		return recipePage{Recipes: recipes, Total: total}, err
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
 
+	setPageHeaders(c, opts.Page, opts.Size, result.Total)
+	if len(opts.Fields) > 0 {
+		c.JSON(http.StatusOK, project(result.Recipes, opts.Fields))
+		return
+	}
+	c.JSON(http.StatusOK, result.Recipes)
 }
 
 // swagger:operation POST /recipes recipes newRecipe
@@ -109,34 +101,77 @@ func (handler *RecipesHandler) ListRecipesHandler(c *gin.Context) {
 //         description: Successful operation
 //     '400':
 //         description: Invalid input
+//     '422':
+//         description: Recipe fails validation
 func (handler *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 
 	// validate request
 	var recipe models.Recipe
 	if err := c.ShouldBindJSON(&recipe); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, invalidInput(err))
+		return
+	}
+	recipe.Normalize()
+	if err := recipe.Validate(); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
 	// insert to database
 	recipe.ID = primitive.NewObjectID()
 	recipe.PublishedAt = time.Now()
-	_, err := handler.collection.InsertOne(handler.ctx, recipe)
+	recipe.Author = CurrentUser(c)
+	err := handler.store.Create(c.Request.Context(), &recipe)
 
 	// response the result
 	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Error while inserting a new recipe",
-		})
+		abortWithError(c, fmt.Errorf("insert recipe: %w", err))
 		return
 	}
 
-	// clear redis cache
-	log.Println("Remove data from Redis")
-	handler.redisClient.DebugObject(recipes_key)
+	// clear cache
+	handler.invalidateCache(c.Request.Context())
+
+	c.JSON(http.StatusOK, recipe)
+}
+
+// swagger:operation GET /recipes/{id} recipes oneRecipe
+// Get one recipe
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: id
+//     in: path
+//     description: recipe ID
+//     required: true
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: Invalid recipe ID
+func (handler *RecipesHandler) GetRecipeHandler(c *gin.Context) {
+	// Checked before the cache so that arbitrary IDs cannot address other
+	// cache entries.
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		abortWithError(c, notFound("Recipe not found"))
+		return
+	}
+	id := objectID.Hex()
+	var recipe models.Recipe
+	err = handler.cached(c, recipeKey(id), handler.cacheTTL.Recipe, &recipe, func(ctx context.Context) (interface{}, error) {
+		return handler.store.Get(ctx, id)
+	})
+	if err == store.ErrNotFound || err == store.ErrInvalidID {
+		abortWithError(c, notFound("Recipe not found"))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, recipe)
 }
@@ -154,57 +189,45 @@ func (handler *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 // - application/json
 // responses:
 //     '200':
-//         description: Successful operation
+//         description: The updated recipe
 //     '400':
-//         description: Invalid input
+//         description: Invalid input or malformed recipe ID
+//     '403':
+//         description: Caller is not the author of the recipe
 //     '404':
-//         description: Invalid recipe ID
+//         description: Recipe not found
+//     '422':
+//         description: Recipe fails validation
 func (handler *RecipesHandler) UpdateRecipeHandler(c *gin.Context) {
 	// validate request
 	id := c.Param("id")
+	if !handler.authorizeOwner(c, id) {
+		return
+	}
 	var recipe models.Recipe
 	if err := c.ShouldBindJSON(&recipe); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, invalidInput(err))
+		return
+	}
+	recipe.Normalize()
+	if err := recipe.Validate(); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
 	// update to database
-	objectId, _ := primitive.ObjectIDFromHex(id)
-	_, err = handler.collection.UpdateOne(
-		handler.ctx,
-		bson.M{
-			"_id": objectId,
-		},
-		bson.D{
-			{
-				"$set", bson.D{
-					{"name", recipe.Name},
-					{"instructions", recipe.Instructions},
-					{"ingredients", recipe.Ingredients},
-					{"tags", recipe.Tags},
-				},
-			},
-		},
-	)
+	updated, err := handler.store.Update(c.Request.Context(), id, recipe)
 
 	// response the result
 	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, fmt.Errorf("update recipe %s: %w", id, err))
 		return
 	}
 
-	// clear redis cache
-	log.Println("Remove data from Redis")
-	handler.redisClient.DebugObject(recipes_key)
+	// clear cache
+	handler.invalidateCache(c.Request.Context())
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Recipe has been updated",
-	})
+	c.JSON(http.StatusOK, updated)
 }
 
 // swagger:operation DELETE /recipes/{id} recipes deleteRecipe
@@ -221,34 +244,30 @@ func (handler *RecipesHandler) UpdateRecipeHandler(c *gin.Context) {
 // responses:
 //     '200':
 //         description: Successful operation
+//     '400':
+//         description: Malformed recipe ID
+//     '403':
+//         description: Caller is not the author of the recipe
 //     '404':
-//         description: Invalid recipe ID
+//         description: Recipe not found
 func (handler *RecipesHandler) DeleteRecipesHandler(c *gin.Context) {
 	// validate request
 	id := c.Param("id")
-	objectId, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	if !handler.authorizeOwner(c, id) {
+		return
 	}
 
 	// delete from database
-	_, err = handler.collection.DeleteOne(handler.ctx, bson.M{
-		"_id": objectId,
-	})
+	err := handler.store.Delete(c.Request.Context(), id)
 
 	// response the result
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		abortWithError(c, fmt.Errorf("delete recipe %s: %w", id, err))
 		return
 	}
 
-	// clear redis cache
-	log.Println("Remove data from Redis")
-	handler.redisClient.DebugObject(recipes_key)
+	// clear cache
+	handler.invalidateCache(c.Request.Context())
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Recipe has been deleted",
@@ -256,35 +275,96 @@ func (handler *RecipesHandler) DeleteRecipesHandler(c *gin.Context) {
 
 }
 
-// swagger:operation GET /recipes/{id} recipes oneRecipe
-// Get one recipe
+// swagger:operation GET /recipes/search recipes findRecipes
+// Search recipes by tag, name and ingredient
 // ---
 // produces:
 // - application/json
 // parameters:
-//   - name: id
-//     in: path
-//     description: recipe ID
-//     required: true
+//   - name: tag
+//     in: query
+//     description: recipe tag, may be repeated
+//     type: string
+//   - name: name
+//     in: query
+//     description: substring of the recipe name
+//     type: string
+//   - name: ingredient
+//     in: query
+//     description: substring of an ingredient, may be repeated
+//     type: string
+//   - name: op
+//     in: query
+//     description: how filters are combined, and (default) or or
 //     type: string
+//   - name: page
+//     in: query
+//     description: page number starting at 1
+//     type: integer
+//   - name: size
+//     in: query
+//     description: number of recipes per page
+//     type: integer
 // responses:
 //     '200':
 //         description: Successful operation
+//     '400':
+//         description: Invalid input
 func (handler *RecipesHandler) SearchRecipesHandler(c *gin.Context) {
-	tag := c.Query("tag")
-	listOfRecipes := make([]models.Recipe, 0)
-	for i := 0; i < len(recipes); i++ {
-		found := false
-		for _, t := range recipes[i].Tags {
+	page, size, err := parsePage(c)
+	if err != nil {
+		abortWithError(c, badRequest(err.Error()))
+		return
+	}
+	query := store.SearchQuery{
+		Tags:        c.QueryArray("tag"),
+		Name:        c.Query("name"),
+		Ingredients: c.QueryArray("ingredient"),
+		Page:        page,
+		Size:        size,
+	}
+	switch strings.ToLower(c.DefaultQuery("op", "and")) {
+	case "and":
+	case "or":
+		query.MatchAny = true
+	default:
+		abortWithError(c, badRequest("op must be either and or or"))
+		return
+	}
 
-			if strings.EqualFold(t, tag) {
-				found = true
-			}
-		}
-		if found {
-			listOfRecipes = append(listOfRecipes, recipes[i])
-		}
+	listOfRecipes, total, err := handler.store.Search(c.Request.Context(), query)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-	c.JSON(http.StatusOK, listOfRecipes)
+	setPageHeaders(c, page, size, total)
+	c.JSON(http.StatusOK, gin.H{
+		"recipes": listOfRecipes,
+		"page":    page,
+		"size":    size,
+		"total":   total,
+	})
 
 }
+
+// authorizeOwner lets the request through when the caller created the
+// recipe or is an admin, otherwise it writes the error response and
+// returns false: 400 for a malformed ID, 404 for an unknown recipe.
+func (handler *RecipesHandler) authorizeOwner(c *gin.Context, id string) bool {
+	recipe, err := handler.store.Get(c.Request.Context(), id)
+	switch {
+	case err == store.ErrNotFound:
+		abortWithError(c, notFound("Recipe not found"))
+		return false
+	case err != nil:
+		abortWithError(c, err)
+		return false
+	}
+
+	username := CurrentUser(c)
+	if HasRole(c, models.RoleAdmin) || (username != "" && username == recipe.Author) {
+		return true
+	}
+	abortWithError(c, forbidden("Only the author can modify this recipe"))
+	return false
+}
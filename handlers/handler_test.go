@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bunyawats/recipes-api/cache"
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const updateBody = `{"name":"Pancakes","ingredients":["flour","milk"],"instructions":["mix","fry"],"tags":["breakfast"]}`
+
+// newRecipesRouter serves the recipe handlers from an in-memory store,
+// authenticated as username.
+func newRecipesRouter(username string, recipes ...models.Recipe) *gin.Engine {
+	return newStoreRouter(username, store.NewMemoryStore(recipes...))
+}
+
+func newStoreRouter(username string, recipeStore store.RecipeStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := NewRecipesHandler(
+		context.Background(),
+		config.Cache{},
+		recipeStore,
+		cache.NewMemoryCache(),
+	)
+	router := gin.New()
+	router.Use(Recovery(), func(c *gin.Context) {
+		c.Set(principalKey, &Principal{
+			Username: username,
+			Roles:    []string{models.RoleEditor},
+		})
+	})
+	router.GET("/recipes", handler.ListRecipesHandler)
+	router.GET("/recipes/:id", handler.GetRecipeHandler)
+	router.PUT("/recipes/:id", handler.UpdateRecipeHandler)
+	router.DELETE("/recipes/:id", handler.DeleteRecipesHandler)
+	return router
+}
+
+func TestUpdateAndDeleteRecipe(t *testing.T) {
+	existing := models.Recipe{
+		ID:           primitive.NewObjectID(),
+		Name:         "Waffles",
+		Ingredients:  []string{"flour"},
+		Instructions: []string{"bake"},
+		Author:       "alice",
+	}
+	unknown := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name     string
+		method   string
+		id       string
+		username string
+		status   int
+		code     string
+	}{
+		{"update malformed ID", http.MethodPut, "not-an-id", "alice", http.StatusBadRequest, CodeBadRequest},
+		{"update unknown ID", http.MethodPut, unknown, "alice", http.StatusNotFound, CodeNotFound},
+		{"update by non-owner", http.MethodPut, existing.ID.Hex(), "bob", http.StatusForbidden, CodeForbidden},
+		{"update by owner", http.MethodPut, existing.ID.Hex(), "alice", http.StatusOK, ""},
+		{"delete malformed ID", http.MethodDelete, "not-an-id", "alice", http.StatusBadRequest, CodeBadRequest},
+		{"delete unknown ID", http.MethodDelete, unknown, "alice", http.StatusNotFound, CodeNotFound},
+		{"delete by non-owner", http.MethodDelete, existing.ID.Hex(), "bob", http.StatusForbidden, CodeForbidden},
+		{"delete by owner", http.MethodDelete, existing.ID.Hex(), "alice", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRecipesRouter(tt.username, existing)
+			request := httptest.NewRequest(tt.method, "/recipes/"+tt.id, strings.NewReader(updateBody))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.code == "" {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != problemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, problemContentType)
+			}
+			var problem APIError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode error body: %v", err)
+			}
+			if problem.Code != tt.code {
+				t.Errorf("code = %q, want %q", problem.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestGetRecipe(t *testing.T) {
+	existing := models.Recipe{ID: primitive.NewObjectID(), Name: "Waffles", Author: "alice"}
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"existing", existing.ID.Hex(), http.StatusOK},
+		{"unknown", primitive.NewObjectID().Hex(), http.StatusNotFound},
+		{"malformed", "not-an-id", http.StatusNotFound},
+		{"cache key", "list:page=1:size=20:sort=:fields=", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRecipesRouter("alice", existing)
+			// Warm the listing cache so that a key lookup would hit.
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/recipes", nil))
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/recipes/"+tt.id, nil))
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestUpdateRecipeReturnsUpdatedRecipe(t *testing.T) {
+	id := primitive.NewObjectID()
+	router := newRecipesRouter("alice", models.Recipe{
+		ID:           id,
+		Name:         "Waffles",
+		Ingredients:  []string{"flour"},
+		Instructions: []string{"bake"},
+		Author:       "alice",
+	})
+	request := httptest.NewRequest(http.MethodPut, "/recipes/"+id.Hex(), strings.NewReader(updateBody))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	var recipe models.Recipe
+	if err := json.Unmarshal(recorder.Body.Bytes(), &recipe); err != nil {
+		t.Fatalf("decode recipe: %v", err)
+	}
+	if recipe.ID != id || recipe.Name != "Pancakes" || recipe.Author != "alice" {
+		t.Errorf("recipe = %+v, want ID %s named Pancakes by alice", recipe, id.Hex())
+	}
+	if len(recipe.Tags) != 1 || recipe.Tags[0] != "breakfast" {
+		t.Errorf("tags = %v, want [breakfast]", recipe.Tags)
+	}
+}
+
+func TestDeleteRecipeRemovesIt(t *testing.T) {
+	id := primitive.NewObjectID()
+	router := newRecipesRouter("alice", models.Recipe{ID: id, Name: "Waffles", Author: "alice"})
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/recipes/"+id.Hex(), nil))
+		if recorder.Code != want {
+			t.Fatalf("status = %d, want %d: %s", recorder.Code, want, recorder.Body)
+		}
+	}
+}
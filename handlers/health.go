@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthStatusUp   = "up"
+	healthStatusDown = "down"
+
+	defaultHealthCheckTimeout = 2 * time.Second
+)
+
+var errJWKSNotLoaded = errors.New("JWKS has not been loaded")
+
+// HealthCheck reports whether a dependency is usable. It should give up
+// once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves the liveness and readiness probes. Readiness runs
+// every registered check concurrently, each bounded by the timeout.
+type HealthHandler struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]HealthCheck
+}
+
+// CheckResult is the outcome of one dependency check.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Latency   string  `json:"latency"`
+	LatencyMs float64 `json:"latencyMs"`
+	// Error is logged but not served, readiness is unauthenticated.
+	Error string `json:"-"`
+}
+
+func NewHealthHandler(timeout time.Duration) *HealthHandler {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	return &HealthHandler{
+		timeout: timeout,
+		checks:  make(map[string]HealthCheck),
+	}
+}
+
+// Add registers check under name; a later check with the same name
+// replaces the earlier one.
+func (handler *HealthHandler) Add(name string, check HealthCheck) {
+	if _, ok := handler.checks[name]; !ok {
+		handler.names = append(handler.names, name)
+	}
+	handler.checks[name] = check
+}
+
+// swagger:operation GET /healthz health liveness
+// Reports that the process is up and serving requests
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+func (handler *HealthHandler) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": healthStatusUp,
+	})
+}
+
+// swagger:operation GET /readyz health readiness
+// Reports whether every dependency is reachable
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Every dependency is up
+//     '503':
+//         description: At least one dependency is down
+func (handler *HealthHandler) ReadinessHandler(c *gin.Context) {
+	results := handler.Check(c.Request.Context())
+
+	status, code := healthStatusUp, http.StatusOK
+	for name, result := range results {
+		if result.Status != healthStatusUp {
+			status, code = healthStatusDown, http.StatusServiceUnavailable
+			Logger(c).Warn("dependency is down", slog.String("dependency", name), slog.String("error", result.Error))
+		}
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// Check runs every registered check and returns their results by name.
+func (handler *HealthHandler) Check(ctx context.Context) map[string]CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, handler.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]CheckResult, len(handler.names))
+	for _, name := range handler.names {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, handler.checks[name])
+	}
+	wg.Wait()
+	return results
+}
+
+// runCheck times check, and counts it as down if it outlives ctx even when
+// the dependency ignores the deadline.
+func runCheck(ctx context.Context, check HealthCheck) CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	latency := time.Since(start)
+
+	result := CheckResult{
+		Status:    healthStatusUp,
+		Latency:   latency.String(),
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = healthStatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// KeySetCheck fails until keySet has loaded at least once.
+func KeySetCheck(keySet *KeySet) HealthCheck {
+	return func(ctx context.Context) error {
+		if loaded, _ := keySet.Loaded(); !loaded {
+			return errJWKSNotLoaded
+		}
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/auth0-community/go-auth0"
+	"github.com/bunyawats/recipes-api/logging"
+	"gopkg.in/square/go-jose.v2"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefreshInterval = time.Hour
+	// minJWKSRefreshInterval throttles reloads triggered by tokens signed
+	// with an unknown kid, so that garbage tokens cannot hammer the
+	// provider's JWKS endpoint.
+	minJWKSRefreshInterval = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("no key matches the token kid")
+
+// KeySet is a long-lived cache of a JSON Web Key Set. The source is either
+// an http(s) URL, such as https://tenant.auth0.com/.well-known/jwks.json or
+// a local stand-in server, or a path to a JWKS file (optionally prefixed
+// with file://) for offline use. It implements auth0.SecretProvider.
+type KeySet struct {
+	source string
+	client *http.Client
+
+	mu         sync.RWMutex
+	keys       map[string]jose.JSONWebKey
+	loadedAt   time.Time
+	attemptAt  time.Time
+	refreshing sync.Mutex
+}
+
+func NewKeySet(source string, client *http.Client) *KeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &KeySet{
+		source: source,
+		client: client,
+		keys:   make(map[string]jose.JSONWebKey),
+	}
+}
+
+// Start loads the key set and keeps refreshing it every interval until ctx
+// is cancelled. Failed refreshes keep serving the previous keys.
+func (k *KeySet) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultJWKSRefreshInterval
+	}
+	if err := k.Refresh(ctx); err != nil {
+		logging.FromContext(ctx).Error("loading JWKS failed", slog.String("source", k.source), slog.Any("error", err))
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Refresh(ctx); err != nil {
+				logging.FromContext(ctx).Error("refreshing JWKS failed", slog.String("source", k.source), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Refresh reloads the key set from its source and replaces the cached keys.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	k.refreshing.Lock()
+	defer k.refreshing.Unlock()
+	return k.reload(ctx)
+}
+
+// refreshIfStale reloads the key set unless a reload was attempted within
+// minJWKSRefreshInterval. The check is made once refreshing is held, so
+// callers queued behind a reload reuse its result instead of fetching again.
+func (k *KeySet) refreshIfStale(ctx context.Context) error {
+	k.refreshing.Lock()
+	defer k.refreshing.Unlock()
+
+	k.mu.RLock()
+	recent := time.Since(k.attemptAt) < minJWKSRefreshInterval
+	k.mu.RUnlock()
+	if recent {
+		return nil
+	}
+	return k.reload(ctx)
+}
+
+// reload does the work of Refresh; it must be called with refreshing held.
+func (k *KeySet) reload(ctx context.Context) error {
+	k.mu.Lock()
+	k.attemptAt = time.Now()
+	k.mu.Unlock()
+
+	data, err := k.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	var jwks auth0.JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return fmt.Errorf("decode %s: %w", k.source, err)
+	}
+	if len(jwks.Keys) == 0 {
+		return auth0.ErrNoKeyFound
+	}
+
+	keys := make(map[string]jose.JSONWebKey, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		keys[key.KeyID] = key
+	}
+	k.mu.Lock()
+	k.keys = keys
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Loaded reports whether at least one key set has been loaded, and when.
+func (k *KeySet) Loaded() (bool, time.Time) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return !k.loadedAt.IsZero(), k.loadedAt
+}
+
+// Key returns the key with the given kid. An unknown kid usually means the
+// provider rotated its keys, so the set is reloaded once (at most every
+// minJWKSRefreshInterval) before giving up.
+func (k *KeySet) Key(ctx context.Context, kid string) (jose.JSONWebKey, error) {
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	if err := k.refreshIfStale(ctx); err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	return jose.JSONWebKey{}, ErrUnknownKey
+}
+
+// GetSecret implements auth0.SecretProvider.
+func (k *KeySet) GetSecret(r *http.Request) (interface{}, error) {
+	token, err := bearerExtractor.Extract(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(token.Headers) < 1 {
+		return nil, auth0.ErrNoJWTHeaders
+	}
+	return k.Key(r.Context(), token.Headers[0].KeyID)
+}
+
+func (k *KeySet) lookup(kid string) (jose.JSONWebKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(k.source, "http://") && !strings.HasPrefix(k.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(k.source, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", k.source, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
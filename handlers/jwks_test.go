@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestKeySetUnknownKidBurst checks that tokens with an unknown kid arriving
+// while a reload is in progress share a single JWKS fetch. The server holds
+// the first fetch until every lookup has been started.
+func TestKeySetUnknownKidBurst(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &privateKey.PublicKey,
+		KeyID:     "known",
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches int32
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(fetching)
+			<-release
+		}
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL, server.Client())
+	var wg sync.WaitGroup
+	lookup := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keySet.Key(context.Background(), "unknown"); err != ErrUnknownKey {
+				t.Errorf("Key() error = %v, want %v", err, ErrUnknownKey)
+			}
+		}()
+	}
+	lookup()
+	<-fetching
+	for i := 0; i < 19; i++ {
+		lookup()
+	}
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("fetches = %d, want 1", got)
+	}
+	if _, err := keySet.Key(context.Background(), "known"); err != nil {
+		t.Errorf("Key(known) error = %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const (
+	userAttemptPrefix = "user:"
+	ipAttemptPrefix   = "ip:"
+)
+
+// LockoutPolicy slows down password guessing. After FreeAttempts failures
+// every further failure blocks the username and the client IP for
+// BaseDelay, doubling each time up to MaxDelay. Once a username reaches
+// Threshold failures it is locked for Lockout, even for the right password.
+// Failures are forgotten after Window without any.
+type LockoutPolicy struct {
+	FreeAttempts int64
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Threshold    int64
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	Threshold:    10,
+	Lockout:      15 * time.Minute,
+	Window:       15 * time.Minute,
+}
+
+type LoginThrottle struct {
+	attempts store.AttemptStore
+	policy   LockoutPolicy
+}
+
+func NewLoginThrottle(attempts store.AttemptStore, policy LockoutPolicy) *LoginThrottle {
+	return &LoginThrottle{
+		attempts: attempts,
+		policy:   policy,
+	}
+}
+
+// allow writes a 429 with Retry-After and returns false while the username
+// or the client IP is blocked.
+func (t *LoginThrottle) allow(c *gin.Context, username string) bool {
+	ctx := c.Request.Context()
+	var wait time.Duration
+	for _, key := range attemptKeys(c, username) {
+		blocked, err := t.attempts.BlockedFor(ctx, key)
+		if err != nil {
+			abortWithError(c, err)
+			return false
+		}
+		if blocked > wait {
+			wait = blocked
+		}
+	}
+	if wait <= 0 {
+		return true
+	}
+	c.Header("Retry-After", ceilSeconds(wait))
+	abortWithError(c, NewAPIError(http.StatusTooManyRequests, CodeTooManyAttempts,
+		"Too many failed sign-in attempts, try again later"))
+	return false
+}
+
+// fail records a failed attempt and blocks further ones as the policy
+// requires.
+func (t *LoginThrottle) fail(c *gin.Context, username string) error {
+	ctx := c.Request.Context()
+	for _, key := range attemptKeys(c, username) {
+		count, err := t.attempts.RecordFailure(ctx, key, t.policy.Window)
+		if err != nil {
+			return err
+		}
+		delay := t.policy.delay(count)
+		if key == userAttemptPrefix+username && t.policy.Threshold > 0 && count >= t.policy.Threshold {
+			delay = t.policy.Lockout
+		}
+		if delay > 0 {
+			if err := t.attempts.Block(ctx, key, delay); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// succeed clears the username's failures. The client IP keeps its count so
+// that signing in to one account does not reset guessing at others.
+func (t *LoginThrottle) succeed(ctx context.Context, username string) error {
+	return t.attempts.Reset(ctx, userAttemptPrefix+username)
+}
+
+// Unlock lifts a lockout and forgets the failures of username.
+func (t *LoginThrottle) Unlock(ctx context.Context, username string) error {
+	return t.attempts.Reset(ctx, userAttemptPrefix+username)
+}
+
+func (p LockoutPolicy) delay(failures int64) time.Duration {
+	excess := failures - p.FreeAttempts
+	if excess <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := int64(1); i < excess && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// attemptKeys counts failures per username and per client IP. The IP only
+// comes from X-Forwarded-For when the peer is a trusted proxy, otherwise a
+// client could pick a new one for every guess.
+func attemptKeys(c *gin.Context, username string) []string {
+	return []string{
+		userAttemptPrefix + username,
+		ipAttemptPrefix + c.ClientIP(),
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoginThrottleIgnoresUntrustedForwardedFor sprays one guess at each of
+// many usernames, claiming a new client IP every time. Without trusted
+// proxies the claims are ignored and the peer address gets blocked.
+func TestLoginThrottleIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	throttle := NewLoginThrottle(store.NewMemoryAttemptStore(), LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Minute,
+		Window:       time.Minute,
+	})
+	router := gin.New()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/signin", func(c *gin.Context) {
+		username := c.Query("username")
+		if !throttle.allow(c, username) {
+			return
+		}
+		if err := throttle.fail(c, username); err != nil {
+			t.Fatal(err)
+		}
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for i := 1; i <= 5; i++ {
+		request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/signin?username=user%d", i), nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		want := http.StatusUnauthorized
+		if i == 5 {
+			want = http.StatusTooManyRequests
+		}
+		if recorder.Code != want {
+			t.Fatalf("attempt %d: status = %d, want %d", i, recorder.Code, want)
+		}
+	}
+}
+
+// TestChangePasswordThrottlesOldPasswordGuesses checks that wrong old
+// passwords count towards the lockout, which then holds even for the right
+// one.
+func TestChangePasswordThrottlesOldPasswordGuesses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("0ld-passw0rd"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewAuthHandler(
+		context.Background(),
+		config.Auth{BcryptCost: bcrypt.MinCost},
+		store.NewMemoryUserStore(models.User{Username: "alice", Password: string(hash)}),
+		store.NewMemoryTokenStore(),
+		nil,
+		NewLoginThrottle(store.NewMemoryAttemptStore(), LockoutPolicy{
+			Threshold: 3,
+			Lockout:   time.Hour,
+			Window:    time.Hour,
+		}),
+	)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(principalKey, &Principal{Username: "alice"})
+	})
+	router.PUT("/me/password", handler.ChangePasswordHandler)
+
+	tests := []struct {
+		oldPassword string
+		status      int
+	}{
+		{"guess-1", http.StatusUnauthorized},
+		{"guess-2", http.StatusUnauthorized},
+		{"guess-3", http.StatusUnauthorized},
+		{"0ld-passw0rd", http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		body := fmt.Sprintf(`{"oldPassword":%q,"newPassword":"n3w-passw0rd"}`, tt.oldPassword)
+		request := httptest.NewRequest(http.MethodPut, "/me/password", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != tt.status {
+			t.Fatalf("attempt %d: status = %d, want %d: %s", i+1, recorder.Code, tt.status, recorder.Body)
+		}
+	}
+}
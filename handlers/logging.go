@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"github.com/bunyawats/recipes-api/logging"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestId"
+)
+
+// requestIDPattern keeps client supplied IDs short and free of characters
+// that could forge log lines.
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// RequestLogger gives every request an ID, taken from X-Request-ID when the
+// client sent a usable one, echoes it in the response and logs one line per
+// request once it is served. Handlers log through Logger(c) so that their
+// lines carry the same ID, and the trace ID when RequestTracing ran first.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = xid.New().String()
+		}
+		c.Set(requestIDKey, requestID)
+		c.Header(requestIDHeader, requestID)
+
+		requestLogger := logger.With(slog.String(requestIDKey, requestID))
+		if traceID := tracing.TraceID(c.Request.Context()); traceID != "" {
+			requestLogger = requestLogger.With(slog.String("traceId", traceID))
+		}
+		c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("clientIp", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if username := CurrentUser(c); username != "" {
+			attrs = append(attrs, slog.String("user", username))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		requestLogger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Logger returns the request scoped logger set up by RequestLogger.
+func Logger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
+// RequestID returns the ID RequestLogger assigned to the request.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
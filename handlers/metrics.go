@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"github.com/bunyawats/recipes-api/metrics"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels requests that matched no route, so that scanners
+// probing random paths cannot blow up the number of series.
+const unmatchedRoute = "unmatched"
+
+// RequestMetrics counts every request and observes its latency, labelled
+// with the gin route template rather than the raw path.
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsHandler serves the Prometheus metrics.
+func MetricsHandler() gin.HandlerFunc {
+	return gin.WrapH(metrics.Handler())
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePage reads the page and size query parameters, applying defaults and
+// capping size at maxPageSize.
+func parsePage(c *gin.Context) (int, int, error) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("page must be a positive integer")
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(defaultPageSize)))
+	if err != nil || size < 1 {
+		return 0, 0, errors.New("size must be a positive integer")
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return page, size, nil
+}
+
+// recipePage is one page of recipes together with the size of the whole
+// result set, as stored in the cache.
+type recipePage struct {
+	Recipes []models.Recipe `json:"recipes"`
+	Total   int64           `json:"total"`
+}
+
+var sortableFields = map[string]bool{
+	"name":        true,
+	"publishedAt": true,
+}
+
+func parseListOptions(c *gin.Context) (store.ListOptions, error) {
+	var opts store.ListOptions
+	page, size, err := parsePage(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.Page = page
+	opts.Size = size
+
+	if sortBy := c.Query("sort"); sortBy != "" {
+		opts.Descending = strings.HasPrefix(sortBy, "-")
+		opts.Sort = strings.TrimPrefix(sortBy, "-")
+		if !sortableFields[opts.Sort] {
+			return opts, errors.New("sort must be one of name, -name, publishedAt or -publishedAt")
+		}
+	}
+
+	if fields := c.Query("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if _, ok := store.RecipeFields[field]; !ok {
+				return opts, fmt.Errorf("unknown field %q", field)
+			}
+			opts.Fields = append(opts.Fields, field)
+		}
+		sort.Strings(opts.Fields)
+	}
+	return opts, nil
+}
+
+// setPageHeaders advertises the result size in X-Total-Count and links to
+// the neighbouring pages in an RFC 8288 Link header.
+func setPageHeaders(c *gin.Context, page, size int, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	lastPage := int((total + int64(size) - 1) / int64(size))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	links := []string{
+		pageLink(c, 1, "first"),
+		pageLink(c, lastPage, "last"),
+	}
+	if page > 1 {
+		links = append(links, pageLink(c, page-1, "prev"))
+	}
+	if page < lastPage {
+		links = append(links, pageLink(c, page+1, "next"))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+func pageLink(c *gin.Context, page int, rel string) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=\"%s\"", u.RequestURI(), rel)
+}
+
+// project keeps only the requested JSON fields of each recipe.
+func project(recipes []models.Recipe, fields []string) []map[string]interface{} {
+	projected := make([]map[string]interface{}, 0, len(recipes))
+	for _, recipe := range recipes {
+		data, _ := json.Marshal(recipe)
+		var all map[string]interface{}
+		json.Unmarshal(data, &all)
+
+		item := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			item[field] = all[field]
+		}
+		projected = append(projected, item)
+	}
+	return projected
+}
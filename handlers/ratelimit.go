@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bunyawats/recipes-api/ratelimit"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit applies quota to the route group named group. Requests are
+// counted per API key, then per user when an authentication middleware ran
+// earlier, and per client IP otherwise. Every response carries the
+// RateLimit-* headers; rejected ones get 429 and Retry-After. Limiter
+// failures let the request through.
+func RateLimit(limiter ratelimit.Limiter, group string, quota ratelimit.Quota) gin.HandlerFunc {
+	policy := fmt.Sprintf("%d;w=%d", quota.Limit, int64(quota.Window.Seconds()))
+	return func(c *gin.Context) {
+		if quota.Limit <= 0 {
+			c.Next()
+			return
+		}
+		result, err := limiter.Allow(c.Request.Context(), group+":"+rateLimitKey(c), quota.Limit, quota.Window)
+		if err != nil {
+			Logger(c).Error("rate limit check failed", slog.String("group", group), slog.Any("error", err))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		c.Header("RateLimit-Reset", ceilSeconds(result.Reset))
+		if !result.Allowed {
+			c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			abortWithError(c, NewAPIError(http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey counts anonymous callers by client IP, which honours
+// X-Forwarded-For only from the router's trusted proxies.
+func rateLimitKey(c *gin.Context) string {
+	principal := CurrentPrincipal(c)
+	switch {
+	case principal == nil:
+		return "ip:" + c.ClientIP()
+	case principal.KeyID != "":
+		return "key:" + principal.KeyID
+	default:
+		return "user:" + principal.Username
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/square/go-jose.v2"
+	joseJwt "gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var ErrUnknownSigningKey = errors.New("token is not signed by a known key")
+
+// SigningKey is a private key, or an HMAC secret, used to sign access
+// tokens.
+type SigningKey struct {
+	KeyID     string
+	Algorithm jose.SignatureAlgorithm
+	Key       interface{}
+}
+
+// KeyRing signs access tokens with its first key and verifies them with
+// any of its keys. To rotate, put the new key first and keep the old ones
+// until the tokens they signed have expired. The public halves of
+// asymmetric keys are published through JWKSHandler.
+type KeyRing struct {
+	paths  []string
+	tokens config.Tokens
+
+	mu   sync.RWMutex
+	keys []SigningKey
+}
+
+// NewHMACKeyRing keeps the legacy HS256 behaviour: a single shared secret
+// and nothing to publish.
+func NewHMACKeyRing(secret string, tokens config.Tokens) *KeyRing {
+	return &KeyRing{
+		tokens: tokens,
+		keys: []SigningKey{{
+			Algorithm: jose.HS256,
+			Key:       []byte(secret),
+		}},
+	}
+}
+
+// LoadKeyRing reads PEM encoded RSA (RS256) or Ed25519 (EdDSA) private keys
+// from paths. Key IDs are the RFC 7638 thumbprints of the public keys.
+func LoadKeyRing(paths []string, tokens config.Tokens) (*KeyRing, error) {
+	k := &KeyRing{
+		paths:  paths,
+		tokens: tokens,
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload re-reads the key files, e.g. after a rotation. On error the
+// current keys are kept.
+func (k *KeyRing) Reload() error {
+	if len(k.paths) == 0 {
+		return errors.New("no signing key files configured")
+	}
+	keys := make([]SigningKey, 0, len(k.paths))
+	for _, path := range k.paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Sign serializes claims into a compact JWS with the active key.
+func (k *KeyRing) Sign(claims interface{}) (string, error) {
+	k.mu.RLock()
+	active := k.keys[0]
+	k.mu.RUnlock()
+
+	options := &jose.SignerOptions{}
+	options.WithType("JWT")
+	if active.KeyID != "" {
+		options.WithHeader("kid", active.KeyID)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: active.Algorithm, Key: active.Key}, options)
+	if err != nil {
+		return "", err
+	}
+	return joseJwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// Verify checks the signature of raw against the key named by its kid and
+// decodes the claims. Expiry is left to the caller.
+func (k *KeyRing) Verify(raw string, claims interface{}) error {
+	token, err := joseJwt.ParseSigned(raw)
+	if err != nil {
+		return err
+	}
+	if len(token.Headers) < 1 {
+		return ErrUnknownSigningKey
+	}
+	header := token.Headers[0]
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.KeyID == header.KeyID && string(key.Algorithm) == header.Algorithm {
+			return token.Claims(verificationKey(key.Key), claims)
+		}
+	}
+	return ErrUnknownSigningKey
+}
+
+// JWKS returns the public keys of the ring; HMAC secrets are never
+// published.
+func (k *KeyRing) JWKS() jose.JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := jose.JSONWebKeySet{
+		Keys: make([]jose.JSONWebKey, 0, len(k.keys)),
+	}
+	for _, key := range k.keys {
+		if key.Algorithm == jose.HS256 {
+			continue
+		}
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       verificationKey(key.Key),
+			KeyID:     key.KeyID,
+			Algorithm: string(key.Algorithm),
+			Use:       "sig",
+		})
+	}
+	return set
+}
+
+// swagger:operation GET /.well-known/jwks.json auth jwks
+// Public keys for verifying tokens issued by POST /token
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+func (k *KeyRing) JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, k.JWKS())
+}
+
+func loadSigningKey(path string) (SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := SigningKey{Key: private}
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = jose.RS256
+	case ed25519.PrivateKey:
+		key.Algorithm = jose.EdDSA
+	default:
+		return SigningKey{}, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+
+	public := jose.JSONWebKey{Key: verificationKey(private)}
+	thumbprint, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+	key.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	return key, nil
+}
+
+// verificationKey returns the public half of asymmetric keys and HMAC
+// secrets unchanged.
+func verificationKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case ed25519.PrivateKey:
+		return k.Public()
+	}
+	return key
+}
+
+// ParseClaims verifies raw and rejects it once it has expired or when it
+// was issued by or for someone else.
+func (k *KeyRing) ParseClaims(raw string) (*Claims, error) {
+	claims := &Claims{}
+	if err := k.Verify(raw, claims); err != nil {
+		return nil, err
+	}
+	if err := claims.Valid(); err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(k.tokens.Issuer, true) {
+		return nil, errors.New("token has an unexpected issuer")
+	}
+	if !claims.VerifyAudience(k.tokens.Audience, true) {
+		return nil, errors.New("token has an unexpected audience")
+	}
+	return claims, nil
+}
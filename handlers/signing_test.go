@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/dgrijalva/jwt-go"
+	"testing"
+	"time"
+)
+
+func TestParseClaimsChecksIssuerAndAudience(t *testing.T) {
+	keys := NewHMACKeyRing("secret", config.Tokens{Issuer: "recipes-api", Audience: "recipes"})
+	tests := []struct {
+		name     string
+		issuer   string
+		audience string
+		valid    bool
+	}{
+		{"expected issuer and audience", "recipes-api", "recipes", true},
+		{"other issuer", "someone-else", "recipes", false},
+		{"other audience", "recipes-api", "billing", false},
+		{"no issuer", "", "recipes", false},
+		{"no audience", "recipes-api", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := keys.Sign(&Claims{
+				Username: "alice",
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    tt.issuer,
+					Audience:  tt.audience,
+					ExpiresAt: time.Now().Add(time.Minute).Unix(),
+				},
+			})
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			_, err = keys.ParseClaims(raw)
+			if valid := err == nil; valid != tt.valid {
+				t.Errorf("ParseClaims err = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
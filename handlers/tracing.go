@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"net/http"
+)
+
+// RequestTracing runs every request in a server span named after its gin
+// route, continuing the caller's trace when it sent a traceparent header.
+// The response carries the traceparent of the span.
+func RequestTracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		ctx, span := tracing.StartRequest(c.Request, c.Request.Method+" "+route,
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(c.Request.URL.Path),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		tracing.Inject(ctx, c.Writer.Header())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/store"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"regexp"
+	"unicode"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after the 72nd byte
+	maxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+type UserOutput struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	Disabled bool     `json:"disabled"`
+}
+
+type PasswordChange struct {
+	OldPassword string `json:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+// swagger:operation POST /signup auth signUp
+// Register a new user with read-only access
+// ---
+// produces:
+// - application/json
+// responses:
+//     '201':
+//         description: User created
+//     '400':
+//         description: Invalid username or password
+//     '409':
+//         description: Username already taken
+func (handler *AuthHandler) SignUpHandler(c *gin.Context) {
+
+	// validate request
+	var user models.User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		abortWithError(c, invalidInput(err))
+		return
+	}
+	if !usernamePattern.MatchString(user.Username) {
+		abortWithError(c, badRequest("Username must be 3 to 32 letters, digits, dots, dashes or underscores"))
+		return
+	}
+	if err := validatePassword(user.Password); err != nil {
+		abortWithError(c, badRequest(err.Error()))
+		return
+	}
+
+	// insert to database
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), handler.config.BcryptCost)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	newUser := models.User{
+		Username: user.Username,
+		Password: string(hash),
+		Roles:    models.SignUpRoles,
+	}
+	err = handler.users.Create(c.Request.Context(), newUser)
+	if err == store.ErrUserExists {
+		abortWithError(c, NewAPIError(http.StatusConflict, CodeConflict, err.Error()))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toUserOutput(newUser))
+}
+
+// swagger:operation GET /me auth me
+// Returns the signed in user
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: User no longer exists
+func (handler *AuthHandler) MeHandler(c *gin.Context) {
+	user, ok := handler.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toUserOutput(user))
+}
+
+// swagger:operation PUT /me/password auth changePassword
+// Change the signed in user's password and sign out its other sessions
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+//     '400':
+//         description: Invalid new password
+//     '401':
+//         description: Old password does not match
+//     '429':
+//         description: Too many failed attempts, retry after Retry-After seconds
+func (handler *AuthHandler) ChangePasswordHandler(c *gin.Context) {
+
+	// validate request
+	var change PasswordChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		abortWithError(c, invalidInput(err))
+		return
+	}
+	if err := validatePassword(change.NewPassword); err != nil {
+		abortWithError(c, badRequest(err.Error()))
+		return
+	}
+
+	user, ok := handler.currentUser(c)
+	if !ok {
+		return
+	}
+	// guesses at the old password are throttled like sign-ins
+	if !handler.throttle.allow(c, user.Username) {
+		return
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(change.OldPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		if err := handler.throttle.fail(c, user.Username); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		abortWithError(c, unauthorized("Old password does not match"))
+		return
+	}
+	if err == nil {
+		err = handler.throttle.succeed(c.Request.Context(), user.Username)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// update to database
+	hash, err := bcrypt.GenerateFromPassword([]byte(change.NewPassword), handler.config.BcryptCost)
+	if err == nil {
+		err = handler.users.UpdatePassword(c.Request.Context(), user.Username, string(hash))
+	}
+	if err == nil {
+		err = handler.revokeUserSessions(c.Request.Context(), user.Username, CurrentPrincipal(c).SessionID)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password has been changed",
+	})
+}
+
+// swagger:operation GET /users users listUsers
+// Returns list of users
+// ---
+// produces:
+// - application/json
+// responses:
+//     '200':
+//         description: Successful operation
+func (handler *AuthHandler) ListUsersHandler(c *gin.Context) {
+	users, err := handler.users.List(c.Request.Context())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	output := make([]UserOutput, 0, len(users))
+	for _, user := range users {
+		output = append(output, toUserOutput(user))
+	}
+	c.JSON(http.StatusOK, output)
+}
+
+// swagger:operation POST /users/{username}/disable users disableUser
+// Disable a user, ending its sessions and refusing its API keys
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: username
+//     in: path
+//     description: login of the user
+//     required: true
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: Unknown user
+func (handler *AuthHandler) DisableUserHandler(c *gin.Context) {
+	handler.setDisabled(c, true)
+}
+
+// swagger:operation POST /users/{username}/enable users enableUser
+// Re-enable a disabled user
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: username
+//     in: path
+//     description: login of the user
+//     required: true
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: Unknown user
+func (handler *AuthHandler) EnableUserHandler(c *gin.Context) {
+	handler.setDisabled(c, false)
+}
+
+// swagger:operation POST /users/{username}/unlock users unlockUser
+// Lift a sign-in lockout and forget the user's failed attempts
+// ---
+// produces:
+// - application/json
+// parameters:
+//   - name: username
+//     in: path
+//     description: login of the user
+//     required: true
+//     type: string
+// responses:
+//     '200':
+//         description: Successful operation
+//     '404':
+//         description: Unknown user
+func (handler *AuthHandler) UnlockUserHandler(c *gin.Context) {
+	username := c.Param("username")
+	_, err := handler.users.FindByUsername(c.Request.Context(), username)
+	if err == nil {
+		err = handler.throttle.Unlock(c.Request.Context(), username)
+	}
+	if err == store.ErrUserNotFound {
+		abortWithError(c, notFound(err.Error()))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User has been unlocked",
+	})
+}
+
+func (handler *AuthHandler) setDisabled(c *gin.Context, disabled bool) {
+	username := c.Param("username")
+	err := handler.users.SetDisabled(c.Request.Context(), username, disabled)
+	if err == nil && disabled {
+		err = handler.revokeUserSessions(c.Request.Context(), username, "")
+	}
+	if err == store.ErrUserNotFound {
+		abortWithError(c, notFound(err.Error()))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	user, err := handler.users.FindByUsername(c.Request.Context(), username)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toUserOutput(user))
+}
+
+// currentUser loads the signed in user. On failure it writes the error
+// response and returns false.
+func (handler *AuthHandler) currentUser(c *gin.Context) (models.User, bool) {
+	user, err := handler.users.FindByUsername(c.Request.Context(), CurrentUser(c))
+	if err == store.ErrUserNotFound {
+		abortWithError(c, notFound(err.Error()))
+		return user, false
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return user, false
+	}
+	return user, true
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return errors.New("password must be between 8 and 72 characters")
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain at least one letter and one digit")
+	}
+	return nil
+}
+
+func toUserOutput(user models.User) UserOutput {
+	return UserOutput{
+		Username: user.Username,
+		Roles:    user.RolesOrDefault(),
+		Disabled: user.Disabled,
+	}
+}
@@ -25,33 +25,24 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
-	"fmt"
-	handler "github.com/bunyawats/recipes-api/handlers"
+	"github.com/bunyawats/recipes-api/config"
+	"github.com/bunyawats/recipes-api/logging"
 	"github.com/bunyawats/recipes-api/models"
-	"github.com/gin-contrib/sessions"
-	redisStore "github.com/gin-contrib/sessions/redis"
-	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"golang.org/x/crypto/bcrypt"
-	"html/template"
-	"io/fs"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 const (
-	mongoUriEnv           = "MONGO_URI"
-	mongoDatabaseEnv      = "MONGO_DATABASE"
 	collectionNameRecipes = "recipes"
 	collectionNameUsers   = "users"
-	apiKey                = "X_API_KEY"
-	jwtSecretKey          = "JWT_SECRET"
-	redisUriEnv           = "REDIS_URI"
+	collectionNameAPIKeys = "apikeys"
 	sessionKey            = "recipes_api"
 )
 
@@ -72,13 +63,6 @@ type (
 )
 
 var (
-	authHandler    *handler.AuthHandler
-	recipesHandler *handler.RecipesHandler
-	xApiKey        string
-	store          sessions.Store
-
-	staticRecipes []StaticRecipe
-
 	//go:embed templates
 	templatesFS embed.FS
 
@@ -89,15 +73,12 @@ var (
 	jsonByte []byte
 )
 
-func initLoadRecipes() {
+func initLoadRecipes(cfg config.Mongo) {
 
-	var databaseUri = os.Getenv(mongoUriEnv)
-	var databaseName = os.Getenv(mongoDatabaseEnv)
+	var databaseUri = cfg.URI
+	var databaseName = cfg.Database
 
-	fmt.Println("databaseUri", databaseUri)
-	fmt.Println("databaseName", databaseName)
-	fmt.Println("collectionNameRecipes", collectionNameRecipes)
-	fmt.Println("collectionNameUser", collectionNameUsers)
+	slog.Info("loading recipes", slog.String("database", databaseName), slog.String("collection", collectionNameRecipes))
 
 	recipes := make([]models.Recipe, 0)
 	file, _ := os.ReadFile("recipes.json")
@@ -108,7 +89,9 @@ func initLoadRecipes() {
 		ctx,
 		options.Client().ApplyURI(databaseUri),
 	)
-	log.Println("Connected to MongoDB")
+	if err != nil {
+		fatal("connect to MongoDB failed", err)
+	}
 
 	var lisOfRecipes []interface{}
 	for _, recipe := range recipes {
@@ -117,189 +100,96 @@ func initLoadRecipes() {
 	collection := client.Database(databaseName).Collection(collectionNameRecipes)
 	insertManyResult, err := collection.InsertMany(ctx, lisOfRecipes)
 	if err != nil {
-		log.Fatal(err)
+		fatal("insert recipes failed", err)
 	}
-	log.Println("Inserted recipes: ", len(insertManyResult.InsertedIDs))
+	slog.Info("inserted recipes", slog.Int("count", len(insertManyResult.InsertedIDs)))
 }
 
-//func AuthMiddleware() gin.HandlerFunc {
-//	return func(c *gin.Context) {
-//		if c.GetHeader(apiKey) != xApiKey {
-//			c.AbortWithStatus(http.StatusUnauthorized)
-//		}
-//		c.Next()
-//	}
-//}
-
-func initLoadUser() {
+func initLoadUser(cfg config.Mongo, bcryptCost int) {
 
-	var databaseUri = os.Getenv(mongoUriEnv)
-	var databaseName = os.Getenv(mongoDatabaseEnv)
+	var databaseUri = cfg.URI
+	var databaseName = cfg.Database
 
-	fmt.Println("databaseUri", databaseUri)
-	fmt.Println("databaseName", databaseName)
-	fmt.Println("collectionNameUser", collectionNameUsers)
+	slog.Info("loading users", slog.String("database", databaseName), slog.String("collection", collectionNameUsers))
 
 	users := map[string]string{
 		"admin":    "password",
 		"bunyawat": "password",
 	}
+	roles := map[string][]string{
+		"admin":    {models.RoleAdmin},
+		"bunyawat": {models.RoleEditor},
+	}
 	ctx := context.Background()
 	client, _ := mongo.Connect(ctx, options.Client().ApplyURI(databaseUri))
 	if err := client.Ping(
 		context.TODO(),
 		readpref.Primary(),
 	); err != nil {
-		log.Fatal(err)
+		fatal("connect to MongoDB failed", err)
 	}
 	collectionUsers := client.Database(databaseName).Collection(collectionNameUsers)
 
 	for username, password := range users {
-		fmt.Println(username, password)
+		slog.Info("inserting user", slog.String("username", username))
 
-		hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 		hsPassword := string(hash)
-		fmt.Println("hsPassword", hsPassword)
 
 		collectionUsers.InsertOne(
 			ctx,
 			bson.M{
 				"username": username,
 				"password": hsPassword,
+				"roles":    roles[username],
 			},
 		)
 	}
 }
 
 func _main() {
-	initLoadUser()
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("load configuration failed", err)
+	}
+	initLoadUser(cfg.Mongo, cfg.Auth.BcryptCost)
 }
 
 //func IndexHandler(c *gin.Context) {
 //	c.File("index.html")
 //}
 
-func init() {
-
-	var databaseUri = os.Getenv(mongoUriEnv)
-	var databaseName = os.Getenv(mongoDatabaseEnv)
-	xApiKey = os.Getenv(apiKey)
-	var jwtSecret = os.Getenv(jwtSecretKey)
-	var redisUri = os.Getenv(redisUriEnv)
+// fatal logs why the API cannot start and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
 
-	fmt.Println("databaseUri", databaseUri)
-	fmt.Println("databaseName", databaseName)
-	fmt.Println("collectionNameRecipes", collectionNameRecipes)
-	fmt.Println("collectionNameUser", collectionNameUsers)
-	fmt.Println("xApiKey", xApiKey)
-	fmt.Println("jwtSecret", jwtSecret)
-	fmt.Println("redisUri", redisUri)
+func main() {
 
-	ctx := context.Background()
-	client, err := mongo.Connect(
-		ctx,
-		options.Client().ApplyURI(databaseUri),
-	)
+	// CONFIG_FILE and the environment are read once, here; see config.Load
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("Connect to MongoDB failed:", err.Error())
+		fatal("load configuration failed", err)
 	}
-	collectionRecipes := client.Database(databaseName).Collection(collectionNameRecipes)
-	collectionUsers := client.Database(databaseName).Collection(collectionNameUsers)
-	log.Println("Connected to MongoDB")
-
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisUri,
-		Password: "",
-		DB:       0,
-	})
-	status := redisClient.Ping()
-	fmt.Println(status)
-
-	recipesHandler = handler.NewRecipesHandler(
-		ctx,
-		collectionRecipes,
-		redisClient,
-	)
-	authHandler = handler.NewAuthHandler(ctx, collectionUsers)
-	store, err = redisStore.NewStore(
-		10,
-		"tcp",
-		redisUri,
-		"",
-		[]byte("secret"),
-	)
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
 	if err != nil {
-		log.Fatal("Connect to Redis failed:", err.Error())
+		fatal("create logger failed", err)
 	}
+	slog.SetDefault(logger)
+	slog.Info("loaded configuration", slog.String("config", cfg.String()))
 
-	staticRecipes = make([]StaticRecipe, 0)
-	err = json.Unmarshal(jsonByte, &staticRecipes)
-	if err != nil {
-		log.Panic(err)
-	}
-	fmt.Println("staticRecipes:", staticRecipes)
-
-}
-
-func IndexHandler(c *gin.Context) {
-
-	c.HTML(http.StatusOK, "index.tmpl", gin.H{
-		"recipes": staticRecipes,
-	})
-}
-
-func RecipeHandler(c *gin.Context) {
-	for _, recipe := range staticRecipes {
-		if recipe.ID == c.Param("id") {
-			c.HTML(http.StatusOK, "recipe.tmpl", gin.H{
-				"recipe": recipe,
-			})
-			return
-
-		}
-	}
-	c.File("404.html")
-}
+	// SIGINT and SIGTERM stop the server; in-flight requests are given
+	// cfg.Server.ShutdownTimeout to finish before connections are closed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func main() {
-
-	router := gin.Default()
-	router.Use(sessions.Sessions(sessionKey, store))
-
-	templateFile := template.Must(template.New("").ParseFS(templatesFS, "templates/*.tmpl"))
-
-	fsys, err := fs.Sub(assetsFS, "assets")
+	app, err := NewApp(cfg)
 	if err != nil {
-		panic(err)
+		fatal("start failed", err)
 	}
-
-	router.SetHTMLTemplate(templateFile)
-	router.StaticFS("/assets", http.FS(fsys))
-
-	router.GET("/", IndexHandler)
-	router.GET("/recipes/:id", RecipeHandler)
-
-	router.GET("/recipes", recipesHandler.ListRecipesHandler)
-	router.POST("/signin", authHandler.SignInHandler)
-	router.POST("/refresh", authHandler.RefreshHandler)
-	router.POST("/signout", authHandler.SignOutHandler)
-
-	authorized := router.Group("/")
-	authorized.Use(authHandler.AuthMiddleware())
-	{
-		authorized.POST("/recipes", recipesHandler.NewRecipeHandler)
-		authorized.PUT("/recipes/:id", recipesHandler.UpdateRecipeHandler)
-		authorized.DELETE("/recipes/:id", recipesHandler.DeleteRecipesHandler)
-		//	router.GET("/recipes/search", SearchRecipesHandler)
-	}
-
-	//err = router.RunTLS(
-	//	":443",
-	//	"certs/localhost.crt",
-	//	"certs/localhost.key",
-	//)
-	err = router.Run()
-	if err != nil {
-		log.Fatal(err)
+	if err := app.Run(ctx); err != nil {
+		fatal("server stopped", err)
 	}
+	slog.Info("server stopped")
 }
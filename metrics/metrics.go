@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+	"net/http"
+	"time"
+)
+
+const namespace = "recipes"
+
+// Registry holds every collector of the API along with the Go runtime and
+// process collectors. It is served by Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests by method, gin route and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by method and gin route.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// CacheRequests counts recipe cache lookups by cache (list or recipe)
+	// and result: hit, miss, stale, coalesced, bypass or error.
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Recipe cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+
+	// MongoCommandDuration observes MongoDB command latency by command name
+	// and outcome.
+	MongoCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "mongo",
+		Name:      "command_duration_seconds",
+		Help:      "MongoDB command latency by command and status.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "status"})
+
+	// SignIns counts sign-in attempts by method (session or jwt) and
+	// result: success, failure, throttled, disabled or error.
+	SignIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "signins_total",
+		Help:      "Sign-in attempts by method and result.",
+	}, []string{"method", "result"})
+
+	// Sessions counts sessions started and ended by kind (session or jwt).
+	// The difference approximates the sessions currently open; expired
+	// sessions are never counted as ended.
+	Sessions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "sessions_total",
+		Help:      "Sessions started and ended by kind and event.",
+	}, []string{"kind", "event"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		CacheRequests,
+		MongoCommandDuration,
+		SignIns,
+		Sessions,
+	)
+}
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// MongoMonitor records the latency of every command sent by a client it
+// is installed on, e.g. with options.Client().SetMonitor.
+func MongoMonitor() *event.CommandMonitor {
+	observe := func(command string, status string, nanos int64) {
+		MongoCommandDuration.WithLabelValues(command, status).Observe(time.Duration(nanos).Seconds())
+	}
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			observe(e.CommandName, "success", e.DurationNanos)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			observe(e.CommandName, "failure", e.DurationNanos)
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// APIKey is a per-client credential. Only a hash of the key is stored; the
+// key itself is shown once, when it is issued.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Name       string             `json:"name" bson:"name"`
+	Owner      string             `json:"owner" bson:"owner"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	Hash       string             `json:"-" bson:"hash"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  *time.Time         `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+// Expired reports whether the key has passed its expiry time.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Roles maps the key's scopes onto the roles used to guard routes.
+func (k APIKey) Roles() []string {
+	roles := make([]string, 0, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		switch scope {
+		case ScopeRead:
+			roles = append(roles, RoleViewer)
+		case ScopeWrite:
+			roles = append(roles, RoleEditor)
+		case ScopeAdmin:
+			roles = append(roles, RoleAdmin)
+		}
+	}
+	return roles
+}
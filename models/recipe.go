@@ -1,10 +1,28 @@
 package models
 
 import (
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// Limits on what a recipe may hold.
+const (
+	MaxRecipeNameLength  = 100
+	MaxIngredients       = 50
+	MaxIngredientLength  = 200
+	MaxInstructions      = 100
+	MaxInstructionLength = 1000
+	MaxTags              = 10
+	MaxTagLength         = 30
+)
+
+// tagPattern allows lower-case words joined by single hyphens or
+// underscores, e.g. gluten-free or slow_cooker.
+var tagPattern = regexp.MustCompile(`^[a-z0-9]+([-_][a-z0-9]+)*$`)
+
 // swagger:parameters recipes newRecipe
 type Recipe struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id"`
@@ -12,5 +30,56 @@ type Recipe struct {
 	Tags         []string           `json:"tags" bson:"tags"`
 	Ingredients  []string           `json:"ingredients" bson:"ingredients"`
 	Instructions []string           `json:"instructions" bson:"instructions"`
-	PublishedAt  time.Time          `json:"publishedAt" b`
+	PublishedAt  time.Time          `json:"publishedAt" bson:"publishedAt"`
+	Author       string             `json:"author" bson:"author"`
+}
+
+// Normalize trims and lower-cases the tags, so that GF and gf are the same
+// tag, and drops blank ingredients and instructions, which imported recipes
+// use as paragraph breaks. Call it before Validate.
+func (r *Recipe) Normalize() {
+	for i, tag := range r.Tags {
+		r.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	r.Ingredients = dropBlank(r.Ingredients)
+	r.Instructions = dropBlank(r.Instructions)
+}
+
+func dropBlank(values []string) []string {
+	kept := values[:0]
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// Validate checks the fields a client submits: a name, at least one
+// ingredient and instruction, and a bounded number of unique, well formed
+// tags. It returns a *ValidationError listing every failing field.
+func (r Recipe) Validate() error {
+	var errs fieldErrors
+	errs.text("name", r.Name, MaxRecipeNameLength)
+	errs.list("ingredients", r.Ingredients, true, MaxIngredients, MaxIngredientLength)
+	errs.list("instructions", r.Instructions, true, MaxInstructions, MaxInstructionLength)
+
+	if len(r.Tags) > MaxTags {
+		errs.add("tags", CodeTooMany, "must have at most %d items", MaxTags)
+	} else {
+		seen := make(map[string]bool, len(r.Tags))
+		for i, tag := range r.Tags {
+			field := fmt.Sprintf("tags[%d]", i)
+			switch {
+			case len(tag) > MaxTagLength:
+				errs.add(field, CodeTooLong, "must be at most %d characters", MaxTagLength)
+			case !tagPattern.MatchString(tag):
+				errs.add(field, CodeInvalidFormat, "must be lower-case letters and digits separated by single hyphens or underscores")
+			case seen[tag]:
+				errs.add(field, CodeDuplicate, "is repeated")
+			}
+			seen[tag] = true
+		}
+	}
+	return errs.err()
 }
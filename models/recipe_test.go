@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestRecipeTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  []string
+		field string
+		code  string
+	}{
+		{"hyphenated", []string{"gluten-free"}, "", ""},
+		{"underscored", []string{"slow_cooker", "make_ahead"}, "", ""},
+		{"upper-case is lowered", []string{"GF", "FUF"}, "", ""},
+		{"padded", []string{" vegan "}, "", ""},
+		{"punctuation", []string{"main,"}, "tags[0]", CodeInvalidFormat},
+		{"doubled separator", []string{"stir__fry"}, "tags[0]", CodeInvalidFormat},
+		{"duplicate after lowering", []string{"gf", "GF"}, "tags[1]", CodeDuplicate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipe := Recipe{
+				Name:         "Stew",
+				Ingredients:  []string{"beef"},
+				Instructions: []string{"simmer"},
+				Tags:         tt.tags,
+			}
+			recipe.Normalize()
+			err := recipe.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			validation, ok := err.(*ValidationError)
+			if !ok || len(validation.Fields) != 1 {
+				t.Fatalf("Validate() = %v, want one field error", err)
+			}
+			if got := validation.Fields[0]; got.Field != tt.field || got.Code != tt.code {
+				t.Errorf("field error = %+v, want %s %s", got, tt.field, tt.code)
+			}
+		})
+	}
+}
+
+func TestRecipeNormalizeDropsBlankLines(t *testing.T) {
+	recipe := Recipe{
+		Name:         "Stew",
+		Ingredients:  []string{"beef", " "},
+		Instructions: []string{"brown the beef", "\r\n", "simmer"},
+	}
+	recipe.Normalize()
+	if len(recipe.Ingredients) != 1 || len(recipe.Instructions) != 2 {
+		t.Fatalf("ingredients = %q, instructions = %q, want blank lines dropped", recipe.Ingredients, recipe.Instructions)
+	}
+	if err := recipe.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
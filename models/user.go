@@ -1,5 +1,19 @@
 package models
 
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// DefaultRoles are granted to users stored without any roles, who predate
+// roles and could all write recipes.
+var DefaultRoles = []string{RoleEditor}
+
+// SignUpRoles are granted to self-registered users; writing recipes takes
+// an admin's promotion.
+var SignUpRoles = []string{RoleViewer}
+
 // swagger:parameters auth signIn
 type User struct {
 	// User's password
@@ -10,4 +24,16 @@ type User struct {
 	//
 	// required: true
 	Username string `json:"username"`
+	// User's roles, read from the users collection only
+	Roles []string `json:"-" bson:"roles,omitempty"`
+	// Disabled users cannot sign in
+	Disabled bool `json:"-" bson:"disabled"`
+}
+
+// RolesOrDefault returns the user's roles, falling back to DefaultRoles.
+func (u User) RolesOrDefault() []string {
+	if len(u.Roles) == 0 {
+		return DefaultRoles
+	}
+	return u.Roles
 }
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codes identify why a field was rejected, for clients to act on without
+// parsing messages.
+const (
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeTooMany       = "too_many"
+	CodeInvalidFormat = "invalid_format"
+	CodeDuplicate     = "duplicate"
+	CodeInvalidType   = "invalid_type"
+)
+
+// FieldError describes one invalid field. Field is the JSON path of the
+// value, e.g. name or ingredients[2].
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a document.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// fieldErrors collects failures while a document is being checked.
+type fieldErrors []FieldError
+
+func (f *fieldErrors) add(field string, code string, format string, args ...interface{}) {
+	*f = append(*f, FieldError{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns nil when nothing failed, so that callers can compare with nil.
+func (f fieldErrors) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: f}
+}
+
+// text checks that value is not blank and at most max characters.
+func (f *fieldErrors) text(field string, value string, max int) {
+	switch {
+	case strings.TrimSpace(value) == "":
+		f.add(field, CodeRequired, "must not be empty")
+	case len([]rune(value)) > max:
+		f.add(field, CodeTooLong, "must be at most %d characters", max)
+	}
+}
+
+// list checks that values has between one (when required) and max items,
+// each of them non-blank and at most maxLength characters.
+func (f *fieldErrors) list(field string, values []string, required bool, max int, maxLength int) {
+	switch {
+	case required && len(values) == 0:
+		f.add(field, CodeRequired, "must have at least one item")
+	case len(values) > max:
+		f.add(field, CodeTooMany, "must have at most %d items", max)
+	default:
+		for i, value := range values {
+			f.text(fmt.Sprintf("%s[%d]", field, i), value, maxLength)
+		}
+	}
+}
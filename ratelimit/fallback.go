@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/logging"
+	"log/slog"
+	"time"
+)
+
+// FallbackLimiter uses primary, normally Redis, and switches to fallback
+// for requests where primary fails, so an outage degrades limits to per
+// instance rather than turning them off.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+}
+
+func NewFallbackLimiter(primary Limiter, fallback Limiter) *FallbackLimiter {
+	return &FallbackLimiter{
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	result, err := l.primary.Allow(ctx, key, limit, window)
+	if err == nil {
+		return result, nil
+	}
+	logging.FromContext(ctx).Warn("rate limiter failed, using fallback", slog.Any("error", err))
+	return l.fallback.Allow(ctx, key, limit, window)
+}
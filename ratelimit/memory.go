@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryCounter struct {
+	start    time.Time
+	current  int64
+	previous int64
+}
+
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	counters  map[string]memoryCounter
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		counters: make(map[string]memoryCounter),
+		now:      time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	start := windowStart(now, window)
+	l.purge(now, window)
+
+	counter := l.counters[key]
+	switch {
+	case counter.start.Equal(start):
+	case counter.start.Add(window).Equal(start):
+		counter = memoryCounter{start: start, previous: counter.current}
+	default:
+		counter = memoryCounter{start: start}
+	}
+	counter.current++
+	l.counters[key] = counter
+	return evaluate(now, counter.previous, counter.current, limit, window), nil
+}
+
+// purge drops counters that no longer affect any decision, at most once
+// per window.
+func (l *MemoryLimiter) purge(now time.Time, window time.Duration) {
+	if now.Sub(l.lastPurge) < window {
+		return
+	}
+	l.lastPurge = now
+	for key, counter := range l.counters {
+		if now.Sub(counter.start) >= 2*window {
+			delete(l.counters, key)
+		}
+	}
+}
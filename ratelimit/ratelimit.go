@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limiter counts requests per key with a sliding window: the count of the
+// current fixed window plus the previous window's count weighted by how
+// much of it still overlaps the sliding window. Rejected requests count
+// too, so clients that keep hammering stay limited.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error)
+}
+
+// Quota allows Limit requests per Window. A zero Limit turns limiting off.
+type Quota struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// ParseQuota reads quotas written as requests/window, e.g. "100/1m". An
+// empty string or "off" disables the limit.
+func ParseQuota(value string) (Quota, error) {
+	if value == "" || value == "off" {
+		return Quota{}, nil
+	}
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Quota{}, fmt.Errorf("quota %q must look like 100/1m", value)
+	}
+	limit, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || limit < 1 {
+		return Quota{}, fmt.Errorf("quota %q must allow at least one request", value)
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return Quota{}, fmt.Errorf("quota %q must have a positive window", value)
+	}
+	return Quota{Limit: limit, Window: window}, nil
+}
+
+// Result describes the quota after a request, in the terms of the
+// RateLimit-* response headers.
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// Reset is how long until the quota is fully replenished.
+	Reset time.Duration
+	// RetryAfter is how long a rejected client should wait.
+	RetryAfter time.Duration
+}
+
+// windowStart returns the start of the fixed window containing now.
+func windowStart(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window)
+}
+
+// evaluate turns the counts of the previous and current fixed windows into
+// a Result.
+func evaluate(now time.Time, previous, current, limit int64, window time.Duration) Result {
+	elapsed := now.Sub(windowStart(now, window))
+	used := int64(float64(previous)*overlap(elapsed, window)) + current
+
+	result := Result{
+		Allowed: used <= limit,
+		Limit:   limit,
+		Reset:   window - elapsed,
+	}
+	if remaining := limit - used; remaining > 0 {
+		result.Remaining = remaining
+	}
+	if !result.Allowed {
+		result.RetryAfter = retryAfter(elapsed, previous, current, limit, window)
+	}
+	return result
+}
+
+// overlap is the share of the previous window still inside the sliding
+// window elapsed into the current one.
+func overlap(elapsed time.Duration, window time.Duration) float64 {
+	return float64(window-elapsed) / float64(window)
+}
+
+// retryAfter solves for the earliest time another request fits the limit:
+// within this window once enough of the previous one has slid out,
+// otherwise in the next window once enough of this one has.
+func retryAfter(elapsed time.Duration, previous, current, limit int64, window time.Duration) time.Duration {
+	if current < limit {
+		share := float64(limit-current-1) / float64(previous)
+		return time.Duration(float64(window)*(1-share)) - elapsed
+	}
+	share := float64(limit-1) / float64(current)
+	return window - elapsed + time.Duration(float64(window)*(1-share))
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// windowBase is aligned to every window used below.
+var windowBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		elapsed    time.Duration
+		previous   int64
+		current    int64
+		allowed    bool
+		remaining  int64
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{"current window only", 0, 0, 5, true, 5, time.Minute, 0},
+		{"previous window fully weighted at the boundary", 0, 10, 1, false, 0, time.Minute, 12 * time.Second},
+		{"previous window half weighted", 30 * time.Second, 10, 5, true, 0, 30 * time.Second, 0},
+		{"previous window weight rounds down", 45 * time.Second, 10, 8, true, 0, 15 * time.Second, 0},
+		{"wait for the previous window to slide out", 30 * time.Second, 10, 6, false, 0, 30 * time.Second, 12 * time.Second},
+		{"wait for the next window", 30 * time.Second, 4, 10, false, 0, 30 * time.Second, 36 * time.Second},
+		{"last instant of the window", time.Minute - time.Second, 0, 11, false, 0, time.Second, time.Second + 120*time.Second/11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evaluate(windowBase.Add(tt.elapsed), tt.previous, tt.current, 10, time.Minute)
+			if result.Allowed != tt.allowed || result.Remaining != tt.remaining || result.Reset != tt.reset {
+				t.Errorf("result = %+v, want allowed %v, remaining %d, reset %s", result, tt.allowed, tt.remaining, tt.reset)
+			}
+			// retryAfter works in floating point, so allow for rounding.
+			if diff := result.RetryAfter - tt.retryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("RetryAfter = %s, want %s", result.RetryAfter, tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		allowed bool
+	}{
+		{"same window", 10 * time.Second, false},
+		{"next window, previous fully weighted", time.Minute, false},
+		{"next window, previous half weighted", 90 * time.Second, true},
+		{"skipped window", 2 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := windowBase
+			limiter := NewMemoryLimiter()
+			limiter.now = func() time.Time { return now }
+			for i := 0; i < 4; i++ {
+				if _, err := limiter.Allow(context.Background(), "k", 4, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			now = now.Add(tt.advance)
+			result, err := limiter.Allow(context.Background(), "k", 4, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v: %+v", result.Allowed, tt.allowed, result)
+			}
+		})
+	}
+}
+
+// TestMemoryLimiterRetryAfter checks that a client waiting the advertised
+// Retry-After, in whole seconds, is let through at any point of the window.
+func TestMemoryLimiterRetryAfter(t *testing.T) {
+	for _, offset := range []time.Duration{0, 15 * time.Second, 59 * time.Second} {
+		now := windowBase.Add(offset)
+		limiter := NewMemoryLimiter()
+		limiter.now = func() time.Time { return now }
+		var result Result
+		for result.RetryAfter == 0 {
+			var err error
+			if result, err = limiter.Allow(context.Background(), "k", 10, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		now = now.Add(time.Duration(math.Ceil(result.RetryAfter.Seconds())) * time.Second)
+		if result, _ := limiter.Allow(context.Background(), "k", 10, time.Minute); !result.Allowed {
+			t.Errorf("offset %s: still limited after Retry-After: %+v", offset, result)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/go-redis/redis"
+	"strconv"
+	"time"
+)
+
+const keyPrefix = "ratelimit:"
+
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+	}
+}
+
+// Allow keeps one counter per key and fixed window, each expiring once it
+// can no longer be the previous window.
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	now := time.Now()
+	start := windowStart(now, window)
+	currentKey := keyPrefix + key + ":" + strconv.FormatInt(start.UnixNano(), 36)
+	previousKey := keyPrefix + key + ":" + strconv.FormatInt(start.Add(-window).UnixNano(), 36)
+
+	var previous *redis.StringCmd
+	var current *redis.IntCmd
+	_, err := tracing.Redis(ctx, l.client).TxPipelined(func(pipe redis.Pipeliner) error {
+		previous = pipe.Get(previousKey)
+		current = pipe.Incr(currentKey)
+		pipe.PExpire(currentKey, 2*window)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return Result{}, err
+	}
+	previousCount, err := previous.Int64()
+	if err != nil && err != redis.Nil {
+		return Result{}, err
+	}
+	return evaluate(now, previousCount, current.Val(), limit, window), nil
+}
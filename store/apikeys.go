@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/bunyawats/recipes-api/models"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKeyStore keeps per-client API keys, looked up by the SHA-256 hash of
+// the key. Hashing is left to the caller.
+type APIKeyStore interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	Get(ctx context.Context, id string) (models.APIKey, error)
+	FindByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// List returns the keys of owner, or every key when owner is empty.
+	List(ctx context.Context, owner string) ([]models.APIKey, error)
+	Delete(ctx context.Context, id string) error
+	Touch(ctx context.Context, id string, usedAt time.Time) error
+}
@@ -0,0 +1,20 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// AttemptStore counts failed sign-in attempts and remembers which keys,
+// usernames or client IPs, are blocked and for how long.
+type AttemptStore interface {
+	// RecordFailure adds a failure for key and returns the number of
+	// failures since the last reset. The count is forgotten once no failure
+	// has been recorded for window.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error)
+	Block(ctx context.Context, key string, duration time.Duration) error
+	// BlockedFor returns how long key stays blocked, zero when it is not.
+	BlockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets the failures and the block of key.
+	Reset(ctx context.Context, key string) error
+}
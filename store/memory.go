@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type MemoryStore struct {
+	mu      sync.RWMutex
+	recipes []models.Recipe
+}
+
+func NewMemoryStore(recipes ...models.Recipe) *MemoryStore {
+	s := &MemoryStore{
+		recipes: make([]models.Recipe, 0, len(recipes)),
+	}
+	s.recipes = append(s.recipes, recipes...)
+	return s
+}
+
+func (s *MemoryStore) List(_ context.Context, opts ListOptions) ([]models.Recipe, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	recipes := make([]models.Recipe, len(s.recipes))
+	copy(recipes, s.recipes)
+	if less := recipeLess(opts.Sort); less != nil {
+		sort.SliceStable(recipes, func(i, j int) bool {
+			if opts.Descending {
+				return less(recipes[j], recipes[i])
+			}
+			return less(recipes[i], recipes[j])
+		})
+	}
+
+	total := int64(len(recipes))
+	if opts.Size > 0 {
+		recipes = paginate(recipes, opts.skip(), opts.Size)
+	}
+	return recipes, total, nil
+}
+
+func recipeLess(field string) func(a, b models.Recipe) bool {
+	switch field {
+	case "id":
+		return func(a, b models.Recipe) bool {
+			return a.ID.Hex() < b.ID.Hex()
+		}
+	case "name":
+		return func(a, b models.Recipe) bool {
+			return a.Name < b.Name
+		}
+	case "publishedAt":
+		return func(a, b models.Recipe) bool {
+			return a.PublishedAt.Before(b.PublishedAt)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (models.Recipe, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.indexOf(id)
+	if err != nil {
+		return models.Recipe{}, err
+	}
+	return s.recipes[i], nil
+}
+
+func (s *MemoryStore) Create(_ context.Context, recipe *models.Recipe) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if recipe.ID.IsZero() {
+		recipe.ID = primitive.NewObjectID()
+	}
+	s.recipes = append(s.recipes, *recipe)
+	return nil
+}
+
+func (s *MemoryStore) Update(_ context.Context, id string, recipe models.Recipe) (models.Recipe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.indexOf(id)
+	if err != nil {
+		return models.Recipe{}, err
+	}
+	s.recipes[i].Name = recipe.Name
+	s.recipes[i].Instructions = recipe.Instructions
+	s.recipes[i].Ingredients = recipe.Ingredients
+	s.recipes[i].Tags = recipe.Tags
+	return s.recipes[i], nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.indexOf(id)
+	if err != nil {
+		return err
+	}
+	s.recipes = append(s.recipes[:i], s.recipes[i+1:]...)
+	return nil
+}
+
+func (s *MemoryStore) Search(_ context.Context, query SearchQuery) ([]models.Recipe, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	listOfRecipes := make([]models.Recipe, 0)
+	for _, recipe := range s.recipes {
+		if matches(recipe, query) {
+			listOfRecipes = append(listOfRecipes, recipe)
+		}
+	}
+	total := int64(len(listOfRecipes))
+	if query.Size > 0 {
+		listOfRecipes = paginate(listOfRecipes, query.skip(), query.Size)
+	}
+	return listOfRecipes, total, nil
+}
+
+func matches(recipe models.Recipe, query SearchQuery) bool {
+	results := make([]bool, 0)
+	for _, tag := range query.Tags {
+		results = append(results, containsFold(recipe.Tags, tag, strings.EqualFold))
+	}
+	if query.Name != "" {
+		results = append(results, substringFold(recipe.Name, query.Name))
+	}
+	for _, ingredient := range query.Ingredients {
+		results = append(results, containsFold(recipe.Ingredients, ingredient, substringFold))
+	}
+
+	if len(results) == 0 {
+		return true
+	}
+	for _, ok := range results {
+		if ok && query.MatchAny {
+			return true
+		}
+		if !ok && !query.MatchAny {
+			return false
+		}
+	}
+	return !query.MatchAny
+}
+
+func containsFold(values []string, want string, match func(string, string) bool) bool {
+	for _, value := range values {
+		if match(value, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func substringFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func paginate(recipes []models.Recipe, skip, size int) []models.Recipe {
+	if skip >= len(recipes) {
+		return make([]models.Recipe, 0)
+	}
+	end := skip + size
+	if end > len(recipes) {
+		end = len(recipes)
+	}
+	return recipes[skip:end]
+}
+
+// indexOf must be called with mu held.
+func (s *MemoryStore) indexOf(id string) (int, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return -1, ErrInvalidID
+	}
+	for i, recipe := range s.recipes {
+		if recipe.ID == objectId {
+			return i, nil
+		}
+	}
+	return -1, ErrNotFound
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]models.APIKey
+}
+
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys: make(map[string]models.APIKey),
+	}
+}
+
+func (s *MemoryAPIKeyStore) Create(_ context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID.Hex()] = *key
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Get(_ context.Context, id string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryAPIKeyStore) FindByHash(_ context.Context, hash string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (s *MemoryAPIKeyStore) List(_ context.Context, owner string) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0)
+	for _, key := range s.keys {
+		if owner == "" || key.Owner == owner {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Touch(_ context.Context, id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = &usedAt
+	s.keys[id] = key
+	return nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryFailures struct {
+	count     int64
+	expiresAt time.Time
+}
+
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string]memoryFailures
+	blocked  map[string]time.Time
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		failures: make(map[string]memoryFailures),
+		blocked:  make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryAttemptStore) RecordFailure(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purge(now)
+	item := s.failures[key]
+	item.count++
+	item.expiresAt = now.Add(window)
+	s.failures[key] = item
+	return item.count, nil
+}
+
+func (s *MemoryAttemptStore) Block(_ context.Context, key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocked[key] = time.Now().Add(duration)
+	return nil
+}
+
+func (s *MemoryAttemptStore) BlockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.blocked[key]
+	if !ok {
+		return 0, nil
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(s.blocked, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (s *MemoryAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.blocked, key)
+	return nil
+}
+
+// purge drops expired counters and blocks so that the maps do not grow
+// with every address that ever failed to sign in.
+func (s *MemoryAttemptStore) purge(now time.Time) {
+	for key, item := range s.failures {
+		if now.After(item.expiresAt) {
+			delete(s.failures, key)
+		}
+	}
+	for key, until := range s.blocked {
+		if now.After(until) {
+			delete(s.blocked, key)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryRefreshToken struct {
+	data      RefreshToken
+	used      bool
+	expiresAt time.Time
+}
+
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	tokens  map[string]memoryRefreshToken
+	revoked map[string]time.Time
+	// sessions maps usernames to their session IDs and when each is
+	// forgotten.
+	sessions map[string]map[string]time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens:   make(map[string]memoryRefreshToken),
+		revoked:  make(map[string]time.Time),
+		sessions: make(map[string]map[string]time.Time),
+	}
+}
+
+func (s *MemoryTokenStore) SaveRefreshToken(_ context.Context, token string, data RefreshToken, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.tokens[token] = memoryRefreshToken{
+		data:      data,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *MemoryTokenStore) ConsumeRefreshToken(_ context.Context, token string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.tokens[token]
+	if !ok || time.Now().After(item.expiresAt) {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if item.used {
+		return item.data, ErrTokenReused
+	}
+	item.used = true
+	s.tokens[token] = item
+	return item.data, nil
+}
+
+func (s *MemoryTokenStore) RevokeSession(_ context.Context, sessionID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[sessionID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryTokenStore) IsSessionRevoked(_ context.Context, sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.revoked[sessionID]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *MemoryTokenStore) TrackSession(_ context.Context, username string, sessionID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	if s.sessions[username] == nil {
+		s.sessions[username] = make(map[string]time.Time)
+	}
+	s.sessions[username][sessionID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryTokenStore) RevokeUserSessions(_ context.Context, username string, keep string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	expiresAt := time.Now().Add(ttl)
+	for sessionID := range s.sessions[username] {
+		if sessionID != keep {
+			s.revoked[sessionID] = expiresAt
+			delete(s.sessions[username], sessionID)
+		}
+	}
+	return nil
+}
+
+// purge drops expired entries; it must be called with mu held.
+func (s *MemoryTokenStore) purge() {
+	now := time.Now()
+	for token, item := range s.tokens {
+		if now.After(item.expiresAt) {
+			delete(s.tokens, token)
+		}
+	}
+	for sessionID, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, sessionID)
+		}
+	}
+	for username, sessions := range s.sessions {
+		for sessionID, expiresAt := range sessions {
+			if now.After(expiresAt) {
+				delete(sessions, sessionID)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.sessions, username)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/models"
+	"sort"
+	"sync"
+)
+
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+}
+
+func NewMemoryUserStore(users ...models.User) *MemoryUserStore {
+	s := &MemoryUserStore{
+		users: make(map[string]models.User, len(users)),
+	}
+	for _, user := range users {
+		s.users[user.Username] = user
+	}
+	return s
+}
+
+func (s *MemoryUserStore) FindByUsername(_ context.Context, username string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryUserStore) Create(_ context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Username]; ok {
+		return ErrUserExists
+	}
+	s.users[user.Username] = user
+	return nil
+}
+
+func (s *MemoryUserStore) UpdatePassword(_ context.Context, username string, hash string) error {
+	return s.update(username, func(user *models.User) {
+		user.Password = hash
+	})
+}
+
+func (s *MemoryUserStore) SetDisabled(_ context.Context, username string, disabled bool) error {
+	return s.update(username, func(user *models.User) {
+		user.Disabled = disabled
+	})
+}
+
+func (s *MemoryUserStore) List(_ context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (s *MemoryUserStore) update(username string, apply func(user *models.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	apply(&user)
+	s.users[username] = user
+	return nil
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/logging"
+	"github.com/bunyawats/recipes-api/models"
+	"github.com/bunyawats/recipes-api/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"regexp"
+)
+
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{
+		collection: collection,
+	}
+}
+
+func (s *MongoStore) List(ctx context.Context, opts ListOptions) ([]models.Recipe, int64, error) {
+	total, err := s.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	field, ok := RecipeFields[opts.Sort]
+	if !ok {
+		field = "_id"
+	}
+	direction := 1
+	if opts.Descending {
+		direction = -1
+	}
+	sort := bson.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: 1})
+	}
+	findOptions := options.Find().SetSort(sort)
+	if opts.Size > 0 {
+		findOptions.SetSkip(int64(opts.skip())).SetLimit(int64(opts.Size))
+	}
+	if len(opts.Fields) > 0 {
+		projection := bson.M{}
+		for _, field := range opts.Fields {
+			if name, ok := RecipeFields[field]; ok {
+				projection[name] = 1
+			}
+		}
+		findOptions.SetProjection(projection)
+	}
+
+	recipes, err := s.find(ctx, bson.M{}, findOptions)
+	return recipes, total, err
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (models.Recipe, error) {
+	var recipe models.Recipe
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return recipe, ErrInvalidID
+	}
+	err = s.collection.FindOne(ctx, bson.M{
+		"_id": objectId,
+	}).Decode(&recipe)
+	if err == mongo.ErrNoDocuments {
+		return recipe, ErrNotFound
+	}
+	return recipe, err
+}
+
+func (s *MongoStore) Create(ctx context.Context, recipe *models.Recipe) error {
+	_, err := s.collection.InsertOne(ctx, recipe)
+	return err
+}
+
+func (s *MongoStore) Update(ctx context.Context, id string, recipe models.Recipe) (models.Recipe, error) {
+	var updated models.Recipe
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return updated, ErrInvalidID
+	}
+	err = s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id": objectId,
+		},
+		bson.D{
+			{
+				Key: "$set", Value: bson.D{
+					{Key: "name", Value: recipe.Name},
+					{Key: "instructions", Value: recipe.Instructions},
+					{Key: "ingredients", Value: recipe.Ingredients},
+					{Key: "tags", Value: recipe.Tags},
+				},
+			},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return updated, ErrNotFound
+	}
+	return updated, err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidID
+	}
+	result, err := s.collection.DeleteOne(ctx, bson.M{
+		"_id": objectId,
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// searchCollation makes tag matches case-insensitive while still being
+// able to use the tags index, which is created with the same collation.
+var searchCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// EnsureIndexes creates the index backing tag filters in Search. Name and
+// ingredient filters are unanchored case-insensitive regexes, which no
+// index can bound, so they scan whatever the tag filters leave.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tags", Value: 1}},
+		Options: options.Index().SetCollation(searchCollation),
+	})
+	return err
+}
+
+func (s *MongoStore) Search(ctx context.Context, query SearchQuery) ([]models.Recipe, int64, error) {
+	filter := searchFilter(query)
+	total, err := s.collection.CountDocuments(
+		ctx,
+		filter,
+		options.Count().SetCollation(searchCollation),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	findOptions := options.Find().
+		SetCollation(searchCollation).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	if query.Size > 0 {
+		findOptions.SetSkip(int64(query.skip())).SetLimit(int64(query.Size))
+	}
+	recipes, err := s.find(ctx, filter, findOptions)
+	return recipes, total, err
+}
+
+func searchFilter(query SearchQuery) bson.M {
+	conditions := bson.A{}
+	for _, tag := range query.Tags {
+		conditions = append(conditions, bson.M{"tags": tag})
+	}
+	if query.Name != "" {
+		conditions = append(conditions, bson.M{"name": containsRegex(query.Name)})
+	}
+	for _, ingredient := range query.Ingredients {
+		conditions = append(conditions, bson.M{"ingredients": containsRegex(ingredient)})
+	}
+
+	switch {
+	case len(conditions) == 0:
+		return bson.M{}
+	case query.MatchAny:
+		return bson.M{"$or": conditions}
+	default:
+		return bson.M{"$and": conditions}
+	}
+}
+
+func containsRegex(value string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(value), Options: "i"}
+}
+
+func (s *MongoStore) find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) ([]models.Recipe, error) {
+	cur, err := s.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cur *mongo.Cursor, ctx context.Context) {
+		err := cur.Close(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Warn("closing cursor failed", slog.Any("error", err))
+		}
+	}(cur, ctx)
+
+	// the cursor span covers decoding plus any getMore round trips
+	cursorCtx, span := tracing.Start(ctx, "mongo.cursor")
+	recipes, err := decodeRecipes(cursorCtx, cur)
+	span.SetAttributes(attribute.Int("recipes.count", len(recipes)))
+	tracing.End(span, err)
+	return recipes, err
+}
+
+func decodeRecipes(ctx context.Context, cur *mongo.Cursor) ([]models.Recipe, error) {
+	recipes := make([]models.Recipe, 0)
+	for cur.Next(ctx) {
+		var recipe models.Recipe
+		if err := cur.Decode(&recipe); err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	return recipes, cur.Err()
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoAPIKeyStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAPIKeyStore(collection *mongo.Collection) *MongoAPIKeyStore {
+	return &MongoAPIKeyStore{
+		collection: collection,
+	}
+}
+
+// EnsureIndexes creates the unique index on hash used to authenticate
+// requests and the index on owner used to list keys.
+func (s *MongoAPIKeyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "owner", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (s *MongoAPIKeyStore) Create(ctx context.Context, key *models.APIKey) error {
+	_, err := s.collection.InsertOne(ctx, key)
+	return err
+}
+
+func (s *MongoAPIKeyStore) Get(ctx context.Context, id string) (models.APIKey, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	return s.findOne(ctx, bson.M{"_id": objectId})
+}
+
+func (s *MongoAPIKeyStore) FindByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	return s.findOne(ctx, bson.M{"hash": hash})
+}
+
+func (s *MongoAPIKeyStore) List(ctx context.Context, owner string) ([]models.APIKey, error) {
+	filter := bson.M{}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+	cur, err := s.collection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]models.APIKey, 0)
+	err = cur.All(ctx, &keys)
+	return keys, err
+}
+
+func (s *MongoAPIKeyStore) Delete(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *MongoAPIKeyStore) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+	_, err = s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectId},
+		bson.M{"$set": bson.M{"lastUsedAt": usedAt}},
+	)
+	return err
+}
+
+func (s *MongoAPIKeyStore) findOne(ctx context.Context, filter bson.M) (models.APIKey, error) {
+	var key models.APIKey
+	err := s.collection.FindOne(ctx, filter).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, err
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoUserStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoUserStore(collection *mongo.Collection) *MongoUserStore {
+	return &MongoUserStore{
+		collection: collection,
+	}
+}
+
+// EnsureIndexes creates the unique index on username that Create relies on
+// to reject duplicates.
+func (s *MongoUserStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *MongoUserStore) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := s.collection.FindOne(ctx, bson.M{
+		"username": username,
+	}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *MongoUserStore) Create(ctx context.Context, user models.User) error {
+	_, err := s.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserExists
+	}
+	return err
+}
+
+func (s *MongoUserStore) UpdatePassword(ctx context.Context, username string, hash string) error {
+	return s.update(ctx, username, bson.M{"password": hash})
+}
+
+func (s *MongoUserStore) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	return s.update(ctx, username, bson.M{"disabled": disabled})
+}
+
+func (s *MongoUserStore) List(ctx context.Context) ([]models.User, error) {
+	cur, err := s.collection.Find(
+		ctx,
+		bson.M{},
+		options.Find().SetSort(bson.D{{Key: "username", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0)
+	err = cur.All(ctx, &users)
+	return users, err
+}
+
+func (s *MongoUserStore) update(ctx context.Context, username string, set bson.M) error {
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"username": username},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
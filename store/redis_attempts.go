@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+const (
+	failuresPrefix = "auth:failures:"
+	blockedPrefix  = "auth:blocked:"
+)
+
+type RedisAttemptStore struct {
+	client *redis.Client
+}
+
+func NewRedisAttemptStore(client *redis.Client) *RedisAttemptStore {
+	return &RedisAttemptStore{
+		client: client,
+	}
+}
+
+func (s *RedisAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	var count *redis.IntCmd
+	_, err := tracing.Redis(ctx, s.client).TxPipelined(func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(failuresPrefix + key)
+		pipe.PExpire(failuresPrefix+key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+func (s *RedisAttemptStore) Block(ctx context.Context, key string, duration time.Duration) error {
+	return tracing.Redis(ctx, s.client).Set(blockedPrefix+key, 1, duration).Err()
+}
+
+func (s *RedisAttemptStore) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := tracing.Redis(ctx, s.client).PTTL(blockedPrefix + key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL is negative for keys that do not exist
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisAttemptStore) Reset(ctx context.Context, key string) error {
+	return tracing.Redis(ctx, s.client).Del(failuresPrefix+key, blockedPrefix+key).Err()
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bunyawats/recipes-api/tracing"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+const (
+	refreshTokenPrefix = "auth:refresh:"
+	usedTokenPrefix    = "auth:refresh:used:"
+	revokedPrefix      = "auth:revoked:"
+	userSessionsPrefix = "auth:sessions:"
+)
+
+type RedisTokenStore struct {
+	client *redis.Client
+}
+
+func NewRedisTokenStore(client *redis.Client) *RedisTokenStore {
+	return &RedisTokenStore{
+		client: client,
+	}
+}
+
+func (s *RedisTokenStore) SaveRefreshToken(ctx context.Context, token string, data RefreshToken, ttl time.Duration) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tracing.Redis(ctx, s.client).Set(refreshTokenPrefix+token, value, ttl).Err()
+}
+
+func (s *RedisTokenStore) ConsumeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	client := tracing.Redis(ctx, s.client)
+	var data RefreshToken
+	value, err := client.Get(refreshTokenPrefix + token).Bytes()
+	if err == redis.Nil {
+		return data, ErrTokenNotFound
+	}
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(value, &data); err != nil {
+		return data, err
+	}
+
+	// SETNX is the atomic step: only the first caller gets to mark the
+	// token as used, the marker lives as long as the token itself.
+	ttl, err := client.TTL(refreshTokenPrefix + token).Result()
+	if err != nil {
+		return data, err
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	first, err := client.SetNX(usedTokenPrefix+token, 1, ttl).Result()
+	if err != nil {
+		return data, err
+	}
+	if !first {
+		return data, ErrTokenReused
+	}
+	return data, nil
+}
+
+func (s *RedisTokenStore) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	return tracing.Redis(ctx, s.client).Set(revokedPrefix+sessionID, 1, ttl).Err()
+}
+
+// TrackSession keeps the set of a user's sessions alive for ttl after the
+// last one was tracked.
+func (s *RedisTokenStore) TrackSession(ctx context.Context, username string, sessionID string, ttl time.Duration) error {
+	_, err := tracing.Redis(ctx, s.client).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(userSessionsPrefix+username, sessionID)
+		pipe.PExpire(userSessionsPrefix+username, ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisTokenStore) RevokeUserSessions(ctx context.Context, username string, keep string, ttl time.Duration) error {
+	client := tracing.Redis(ctx, s.client)
+	sessionIDs, err := client.SMembers(userSessionsPrefix + username).Result()
+	if err != nil {
+		return err
+	}
+	_, err = client.TxPipelined(func(pipe redis.Pipeliner) error {
+		for _, sessionID := range sessionIDs {
+			if sessionID != keep {
+				pipe.Set(revokedPrefix+sessionID, 1, ttl)
+				pipe.SRem(userSessionsPrefix+username, sessionID)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisTokenStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := tracing.Redis(ctx, s.client).Exists(revokedPrefix + sessionID).Result()
+	return n > 0, err
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/bunyawats/recipes-api/models"
+)
+
+var (
+	ErrNotFound  = errors.New("recipe not found")
+	ErrInvalidID = errors.New("invalid recipe ID")
+)
+
+// RecipeStore is the persistence layer used by the recipes handlers.
+// MongoStore is the production implementation, MemoryStore keeps
+// everything in process for local runs and unit tests.
+type RecipeStore interface {
+	List(ctx context.Context, opts ListOptions) ([]models.Recipe, int64, error)
+	Get(ctx context.Context, id string) (models.Recipe, error)
+	Create(ctx context.Context, recipe *models.Recipe) error
+	// Update replaces the editable fields of the recipe and returns it as
+	// stored afterwards.
+	Update(ctx context.Context, id string, recipe models.Recipe) (models.Recipe, error)
+	Delete(ctx context.Context, id string) error
+	Search(ctx context.Context, query SearchQuery) ([]models.Recipe, int64, error)
+}
+
+// RecipeFields maps the JSON names of models.Recipe fields, as accepted by
+// the sort and fields query parameters, to their BSON names.
+var RecipeFields = map[string]string{
+	"id":           "_id",
+	"name":         "name",
+	"tags":         "tags",
+	"ingredients":  "ingredients",
+	"instructions": "instructions",
+	"publishedAt":  "publishedAt",
+	"author":       "author",
+}
+
+// ListOptions controls paging, ordering and projection of List. Sort is a
+// key of RecipeFields, an empty Sort keeps insertion order. Fields is a
+// hint: stores may leave the other fields empty but are not required to.
+type ListOptions struct {
+	Page       int
+	Size       int
+	Sort       string
+	Descending bool
+	Fields     []string
+}
+
+func (o ListOptions) skip() int {
+	return skip(o.Page, o.Size)
+}
+
+// SearchQuery filters recipes by tags, a name substring and ingredient
+// substrings. By default every filter must match; MatchAny switches to
+// returning recipes that match at least one of them. Only tag filters are
+// index-backed in MongoStore.
+type SearchQuery struct {
+	Tags        []string
+	Name        string
+	Ingredients []string
+	MatchAny    bool
+	Page        int
+	Size        int
+}
+
+func (q SearchQuery) skip() int {
+	return skip(q.Page, q.Size)
+}
+
+func skip(page, size int) int {
+	if page < 1 {
+		return 0
+	}
+	return (page - 1) * size
+}
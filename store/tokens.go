@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenReused   = errors.New("refresh token already used")
+)
+
+// RefreshToken is what the server remembers about an opaque refresh token.
+// SessionID ties together every access and refresh token issued since the
+// user signed in, so they can be revoked at once.
+type RefreshToken struct {
+	Username  string   `json:"username"`
+	Roles     []string `json:"roles"`
+	SessionID string   `json:"sid"`
+}
+
+// TokenStore keeps refresh tokens and the list of revoked sessions.
+type TokenStore interface {
+	SaveRefreshToken(ctx context.Context, token string, data RefreshToken, ttl time.Duration) error
+	// ConsumeRefreshToken marks token as used and returns its data. Refresh
+	// tokens are single use: a second call returns the data together with
+	// ErrTokenReused so the caller can revoke the session.
+	ConsumeRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	// TrackSession remembers sessionID as one of username's sessions for
+	// ttl, so that RevokeUserSessions can find it.
+	TrackSession(ctx context.Context, username string, sessionID string, ttl time.Duration) error
+	// RevokeUserSessions revokes, for ttl, every tracked session of username
+	// except keep, which may be empty.
+	RevokeUserSessions(ctx context.Context, username string, keep string, ttl time.Duration) error
+}
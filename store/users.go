@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/bunyawats/recipes-api/models"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("username already taken")
+)
+
+// UserStore is the persistence layer for accounts. Passwords are stored as
+// bcrypt hashes; hashing is left to the caller.
+type UserStore interface {
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+	Create(ctx context.Context, user models.User) error
+	UpdatePassword(ctx context.Context, username string, hash string) error
+	SetDisabled(ctx context.Context, username string, disabled bool) error
+	List(ctx context.Context) ([]models.User, error)
+}
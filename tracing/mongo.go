@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/event"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"strconv"
+	"sync"
+)
+
+// MongoMonitor starts a client span for every command sent by a client it
+// is installed on, e.g. with options.Client().SetMonitor. Only the command
+// and collection names are recorded, never the documents.
+func MongoMonitor() *event.CommandMonitor {
+	var spans sync.Map
+	key := func(connectionID string, requestID int64) string {
+		return connectionID + "/" + strconv.FormatInt(requestID, 10)
+	}
+	finish := func(e event.CommandFinishedEvent, err error) {
+		if span, ok := spans.LoadAndDelete(key(e.ConnectionID, e.RequestID)); ok {
+			End(span.(trace.Span), err)
+		}
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			_, span := Start(ctx, "mongo."+e.CommandName,
+				semconv.DBSystemMongoDB,
+				semconv.DBName(e.DatabaseName),
+				semconv.DBOperation(e.CommandName),
+			)
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				span.SetAttributes(semconv.DBMongoDBCollection(collection))
+			}
+			spans.Store(key(e.ConnectionID, e.RequestID), span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.CommandFinishedEvent, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.CommandFinishedEvent, errors.New(e.Failure))
+		},
+	}
+}